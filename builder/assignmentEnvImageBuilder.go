@@ -3,22 +3,16 @@
 package builder
 
 import (
+	"assignment-exec/image-builder/builder/containers"
 	"assignment-exec/image-builder/configurations"
 	"assignment-exec/image-builder/constants"
-	"assignment-exec/image-builder/environment"
-	"bytes"
+	"assignment-exec/image-builder/registry"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"github.com/pkg/errors"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // assignmentEnvironmentImageBuilder is used to build an image with an environment
@@ -26,13 +20,31 @@ import (
 //
 // The image is built in phases to allow for rollback in situations where the execution of a phase fails.
 // Once the configuration passes a verification phase, a Dockerfile is created and
-// the docker client (here - https://github.com/moby/moby/tree/master/client) is used to generate the image.
-// The image is then pushed to docker hub repository, if required.
+// the container engine (by default - docker) is used to generate the image.
+// The image is then pushed to the registry, if required.
 type assignmentEnvironmentImageBuilder struct {
-	DockerfileInstructions bytes.Buffer
+	DockerfileInstructions Dockerfile
 	ImgBuildConfig         *imageBuildConfig
 	AsgmtEnvConfig         *configurations.AssignmentEnvConfig
 	ImageExists            bool
+	LanguageImageExists    bool
+	LanguageImageRef       string
+	BaseImageDigest        string
+	LanguageImageDigest    string
+	ImageID                string
+	ImageDigest            string
+	BuildStageInstructions Dockerfile
+	SingleStageSize        int64
+	ImageSize              int64
+	engine                 containers.ContainerEngine
+	registryClient         *registry.Client
+	renderer               ProgressRenderer
+	timeouts               configurations.PhaseTimeouts
+	envLockFilepath        string
+	envLock                *configurations.EnvLock
+	updateEnvLock          bool
+	verbose                bool
+	assets                 []configurations.ResolvedAsset
 }
 
 // assignmentEnvironmentImageBuilderOption represents options that can be used to help initialize
@@ -51,6 +63,20 @@ func newAssignmentEnvironmentImageBuilder(options ...assignmentEnvironmentImageB
 			return nil, errors.Wrap(err, "failed to create assignmentEnvironmentImageBuilder instance")
 		}
 	}
+
+	// Use the docker engine if no other container engine has been provided.
+	if asgmtEnv.engine == nil {
+		engine, err := NewDockerEngine()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create assignmentEnvironmentImageBuilder instance")
+		}
+		asgmtEnv.engine = engine
+	}
+	// Render the progress as plain text on stderr if no other renderer has been provided,
+	// so that it is not mixed into the output of the commands, e.g the rendered dockerfile.
+	if asgmtEnv.renderer == nil {
+		asgmtEnv.renderer = &plainRenderer{writer: os.Stderr}
+	}
 	return asgmtEnv, nil
 }
 
@@ -80,19 +106,108 @@ func withAsgmtEnvConfig(assignCfgs *configurations.AssignmentEnvConfig) assignme
 	}
 }
 
+// WithContainerEngine returns an assignmentEnvironmentImageBuilderOption for
+// initializing the container engine used to build, publish and remove images.
+func WithContainerEngine(engine containers.ContainerEngine) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		if engine == nil {
+			return errors.New("container engine not provided")
+		}
+		asgmtEnv.engine = engine
+		return nil
+	}
+}
+
+// WithProgressRenderer returns an assignmentEnvironmentImageBuilderOption for
+// initializing the renderer of the build, push and pull progress.
+func WithProgressRenderer(renderer ProgressRenderer) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		if renderer == nil {
+			return errors.New("progress renderer not provided")
+		}
+		asgmtEnv.renderer = renderer
+		return nil
+	}
+}
+
+// withRegistryClient returns an assignmentEnvironmentImageBuilderOption for
+// initializing the client used to query the registries.
+func withRegistryClient(registryClient *registry.Client) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		if registryClient == nil {
+			return errors.New("registry client not provided")
+		}
+		asgmtEnv.registryClient = registryClient
+		return nil
+	}
+}
+
+// WithVerbose returns an assignmentEnvironmentImageBuilderOption for initializing
+// whether the details of the build, e.g the manifest of the build context, are reported.
+func WithVerbose(verbose bool) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		asgmtEnv.verbose = verbose
+		return nil
+	}
+}
+
+// WithPhaseTimeouts returns an assignmentEnvironmentImageBuilderOption for initializing
+// the timeouts of the verify, build and publish phases. The non zero timeouts take
+// precedence over the timeouts in the configuration.
+func WithPhaseTimeouts(timeouts configurations.PhaseTimeouts) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		for _, phase := range []string{"verify", "build", "publish"} {
+			if timeouts.GetTimeout(phase) < 0 {
+				return errors.Errorf("timeout of the %s phase cannot be negative", phase)
+			}
+		}
+		asgmtEnv.timeouts = timeouts
+		return nil
+	}
+}
+
 // verifyAndWriteInstructions checks whether a docker image for the language given in
-// configuration file is already present in docker hub and accordingly writes the Dockerfile
-// from either the base image or from the existing language image.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyAndWriteInstructions() error {
+// configuration file is already present in the registry and accordingly writes the Dockerfile
+// from either the base image or from the existing language image. The instructions written by
+// a previous verification, e.g by planning the commands, are replaced.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyAndWriteInstructions(ctx context.Context) error {
+	asgmtEnv.DockerfileInstructions.Reset()
+	asgmtEnv.BuildStageInstructions.Reset()
+	asgmtEnv.LanguageImageExists = false
+	asgmtEnv.ImageExists = false
+	asgmtEnv.ImgBuildConfig.imageTag = asgmtEnv.ImgBuildConfig.languageTag
+
+	// Verify whether base image is present in registry.
+	if err := asgmtEnv.validateBaseImage(ctx); err != nil {
+		return err
+	}
+
+	// Resolve the files of the assets, which are copied into the image.
+	assets, err := asgmtEnv.AsgmtEnvConfig.ResolveAssets()
+	if err != nil {
+		return errors.Wrap(err, "error in resolving assets")
+	}
+	asgmtEnv.assets = assets
 
 	// Verify whether language image is present in registry.
-	if err := asgmtEnv.verifyLanguage(); err != nil {
+	asgmtEnv.LanguageImageRef = asgmtEnv.ImgBuildConfig.getLanguageImageReference()
+	if err := asgmtEnv.verifyLanguage(ctx); err != nil {
+		// A language image pinned by the lock file must not be silently replaced.
+		if errors.Cause(err) == ErrPinnedImageNotFound {
+			return err
+		}
 		// If no then write the instructions from base image.
-		asgmtEnv.writeInstructionsLayerOnBaseImage()
+		if err := asgmtEnv.writeInstructionsLayerOnBaseImage(); err != nil {
+			return err
+		}
 	} else {
-		if len(asgmtEnv.AsgmtEnvConfig.Deps.Libraries) > 0 {
-			// Else write the instructions from dependencies.
-			asgmtEnv.writeInstructionsLayerOnLanguageImage()
+		asgmtEnv.LanguageImageExists = true
+		if len(asgmtEnv.AsgmtEnvConfig.Deps.Libraries) > 0 || len(asgmtEnv.assets) > 0 ||
+			len(getRuntimeInstructions(asgmtEnv.AsgmtEnvConfig)) > 0 {
+			// Else write the instructions from dependencies, the environment and assets.
+			if err := asgmtEnv.writeInstructionsLayerOnLanguageImage(); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -102,77 +217,159 @@ func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyAndWriteInstructions()
 	return nil
 }
 
-// verifyLanguage searches the docker image for the given language on docker hub.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyLanguage() error {
-	// Check whether the language image is available on docker hub.
-	backgroundContext := context.Background()
-	dockerClient, err := client.NewEnvClient()
-	if err != nil {
-		return err
+// validateBaseImage checks whether the exact base image given in assignment environment config
+// is present in its registry and records its digest. It returns error if image is not already present,
+// which indicates that assignment environment image cannot be generated.
+// The digest pinned by the lock file, if any, is used instead of resolving the tag again.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) validateBaseImage(ctx context.Context) error {
+	if lock := asgmtEnv.getLockedImages(); lock != nil && lock.BaseImage.Reference == asgmtEnv.AsgmtEnvConfig.BaseImage {
+		if err := asgmtEnv.verifyPinnedImage(ctx, lock.BaseImage.Reference, lock.BaseImage.Digest); err != nil {
+			return errors.Wrap(err, "error in verifying code-runner base image")
+		}
+		asgmtEnv.BaseImageDigest = lock.BaseImage.Digest
+		return nil
 	}
-	username, usernameFound := os.LookupEnv(environment.DockerAuthUsername)
-	if !usernameFound {
-		return errors.New("environment variable for username not set")
+
+	baseImage := registry.ParseReference(asgmtEnv.AsgmtEnvConfig.BaseImage)
+	digest, err := asgmtEnv.registryClient.Resolve(ctx, baseImage)
+	if registry.IsNotFound(err) {
+		return errors.Errorf("code-runner base image %s not found", baseImage)
 	}
+	if err != nil {
+		return errors.Wrap(err, "error in verifying code-runner base image")
+	}
+	asgmtEnv.BaseImageDigest = digest
+	return nil
+}
 
-	response, err := dockerClient.ImageSearch(backgroundContext, username, types.ImageSearchOptions{
-		Limit: 25})
+// verifyLanguage checks whether the exact docker image for the given language is present
+// in the registry and records its digest. The lock file, if any, decides whether the
+// language image is used and pins its digest.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyLanguage(ctx context.Context) error {
+	if lock := asgmtEnv.getLockedImages(); lock != nil && lock.LanguageImage.Reference == asgmtEnv.LanguageImageRef {
+		if lock.LanguageImage.Digest == "" {
+			return errors.Errorf("language image %s not locked", asgmtEnv.LanguageImageRef)
+		}
+		if err := asgmtEnv.verifyPinnedImage(ctx, lock.LanguageImage.Reference, lock.LanguageImage.Digest); err != nil {
+			return err
+		}
+		asgmtEnv.LanguageImageDigest = lock.LanguageImage.Digest
+		return nil
+	}
 
+	langImage := registry.ParseReference(asgmtEnv.LanguageImageRef)
+	digest, err := asgmtEnv.registryClient.Resolve(ctx, langImage)
+	if registry.IsNotFound(err) {
+		return errors.Errorf("language image %s not found", langImage)
+	}
 	if err != nil {
 		return err
 	}
-	langImageFound := false
-	for _, result := range response {
-		if strings.Contains(asgmtEnv.ImgBuildConfig.imageTag, result.Name) {
-			langImageFound = true
-		}
+	asgmtEnv.LanguageImageDigest = digest
+	return nil
+}
+
+// GetImageReference returns the reference of the assignment environment image,
+// which holds the digest of the configuration once it has been verified.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) GetImageReference() string {
+	return asgmtEnv.ImgBuildConfig.getImageReference()
+}
+
+// ResolvePublishedImage resolves the digest of the assignment environment image in its registry,
+// once the configuration has been verified. It returns false if the image is not in the registry.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) ResolvePublishedImage(ctx context.Context) (string, bool, error) {
+	digest, err := asgmtEnv.registryClient.Resolve(ctx, registry.ParseReference(asgmtEnv.GetImageReference()))
+	if registry.IsNotFound(err) {
+		return "", false, nil
 	}
-	if !langImageFound {
-		return errors.New("language image not found on docker hub")
+	if err != nil {
+		return "", false, errors.Wrap(err, "error in resolving image in registry")
 	}
+	return digest, true, nil
+}
 
-	return nil
+// getBuildSource returns a description of the image that the assignment
+// environment image is built from, as decided by the verification.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getBuildSource() string {
+	switch {
+	case asgmtEnv.ImageExists:
+		return "existing language image " + asgmtEnv.LanguageImageRef
+	case asgmtEnv.LanguageImageExists:
+		return "language image " + asgmtEnv.LanguageImageRef
+	}
+	return "base image " + asgmtEnv.AsgmtEnvConfig.BaseImage
 }
 
 // writeInstructionsLayerOnBaseImage writes the docker instructions to starting from the
 // base code runner image. Which is then followed by the required language and its dependencies.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) writeInstructionsLayerOnBaseImage() {
-	var instructions []string
-	instructions = append(instructions, asgmtEnv.AsgmtEnvConfig.GetInstruction())
-
-	var libraryNames []string
-	for lib := range asgmtEnv.AsgmtEnvConfig.Deps.Libraries {
-		libraryNames = append(libraryNames, lib)
-	}
-
+func (asgmtEnv *assignmentEnvironmentImageBuilder) writeInstructionsLayerOnBaseImage() error {
 	// Generate the image tag.
-	asgmtEnv.ImgBuildConfig.imageTag = strings.Join([]string{asgmtEnv.ImgBuildConfig.imageTag,
-		strings.Join(libraryNames, "-")}, "-")
-	asgmtEnv.DockerfileInstructions.WriteString(strings.Join(instructions, "\n"))
+	if err := asgmtEnv.setImageTagAndLabels(); err != nil {
+		return err
+	}
+	instructions, err := getBaseImageInstructions(asgmtEnv.AsgmtEnvConfig, asgmtEnv.getBaseImageSource())
+	if err != nil {
+		return err
+	}
+	if err := asgmtEnv.addInstructions(instructions); err != nil {
+		return err
+	}
+	return asgmtEnv.DockerfileInstructions.Validate()
 }
 
 // writeInstructionsLayerOnLanguageImage writes the docker instructions starting
 // from the respective language image. Which is then followed by the language dependencies.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) writeInstructionsLayerOnLanguageImage() {
-	var instructions []string
-
-	// FROM instruction.
-	instructions = append(instructions, fmt.Sprintf("FROM %s", asgmtEnv.ImgBuildConfig.imageTag))
-	// COPY instruction.
-	instructions = append(instructions, fmt.Sprintf("COPY . /"+constants.CodeRunnerDir))
+func (asgmtEnv *assignmentEnvironmentImageBuilder) writeInstructionsLayerOnLanguageImage() error {
+	// Generate the image tag.
+	if err := asgmtEnv.setImageTagAndLabels(); err != nil {
+		return err
+	}
+	instructions, err := getLanguageImageInstructions(asgmtEnv.AsgmtEnvConfig, asgmtEnv.getLanguageImageSource())
+	if err != nil {
+		return err
+	}
+	if err := asgmtEnv.addInstructions(instructions); err != nil {
+		return err
+	}
+	return asgmtEnv.DockerfileInstructions.Validate()
+}
 
-	var libraryNames []string
-	for lib, installCmd := range asgmtEnv.AsgmtEnvConfig.Deps.Libraries {
-		libraryNames = append(libraryNames, lib)
+// addInstructions adds the instructions to the dockerfile, as the build stage
+// followed by the final stage if the image is built in multiple stages, and then the
+// instructions setting the environment of the container and copying the assets.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) addInstructions(instructions []Instruction) error {
+	if asgmtEnv.AsgmtEnvConfig.MultiStage.Enabled {
+		asgmtEnv.BuildStageInstructions.Add(instructions...)
+		multiStageInstructions, err := getMultiStageInstructions(asgmtEnv.AsgmtEnvConfig, instructions, asgmtEnv.getBaseImageSource())
+		if err != nil {
+			return err
+		}
+		instructions = multiStageInstructions
+	}
+	asgmtEnv.DockerfileInstructions.Add(instructions...)
+	asgmtEnv.DockerfileInstructions.Add(getRuntimeInstructions(asgmtEnv.AsgmtEnvConfig)...)
+	asgmtEnv.DockerfileInstructions.Add(getAssetInstructions(asgmtEnv.assets)...)
+	return nil
+}
 
-		// RUN instruction.
-		instructions = append(instructions, "RUN "+installCmd.GetInstruction()+" "+lib)
+// setImageTagAndLabels suffixes the language image tag with a short digest of the
+// canonical configuration, so that identical configurations always map to the same
+// image, and records the human readable configuration details as image labels.
+// The tag is derived from the language tag every time, so verifying again yields the same tag.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) setImageTagAndLabels() error {
+	digest, err := asgmtEnv.AsgmtEnvConfig.GetDigest()
+	if err != nil {
+		return errors.Wrap(err, "error in generating image tag")
+	}
+	labels, err := asgmtEnv.AsgmtEnvConfig.GetLabels()
+	if err != nil {
+		return errors.Wrap(err, "error in generating image labels")
 	}
 
-	// Generate the image tag.
-	asgmtEnv.ImgBuildConfig.imageTag = strings.Join([]string{asgmtEnv.ImgBuildConfig.imageTag,
-		strings.Join(libraryNames, "-")}, "-")
-	asgmtEnv.DockerfileInstructions.WriteString(strings.Join(instructions, "\n"))
+	asgmtEnv.ImgBuildConfig.imageTag = fmt.Sprintf("%s-%s", asgmtEnv.ImgBuildConfig.languageTag,
+		digest[:constants.TagDigestLength])
+	asgmtEnv.ImgBuildConfig.imageLabels = labels
+	return nil
 }
 
 // writeToDockerfile creates a Dockerfile at the specified location and writes
@@ -199,85 +396,155 @@ func (asgmtEnv *assignmentEnvironmentImageBuilder) writeToDockerfile() error {
 }
 
 // build a docker image for the given assignment environment. If the image is already present,
-// then it simply pull the image.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) build() error {
+// then it simply pull the image. An image built in multiple stages is compared with the image
+// that its build stage alone would produce, and both sizes are reported.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) build(ctx context.Context) error {
 
 	if !asgmtEnv.ImageExists {
-		backgroundContext := context.Background()
-		dockerClient, err := client.NewEnvClient()
-		if err != nil {
-			return errors.Wrap(err, "error in creating a docker client")
+		if asgmtEnv.AsgmtEnvConfig.MultiStage.Enabled {
+			size, err := asgmtEnv.getBuildStageSize(ctx)
+			if err != nil {
+				return err
+			}
+			asgmtEnv.SingleStageSize = size
 		}
 
-		// Create a build context tar for the image.
-		// build Context is the current working directory and where the Dockerfile is assumed to be located.
-		// [cite: https://docs.docker.com/develop/develop-images/dockerfile_best-practices/].
-		dockerfileLoc := filepath.Base(asgmtEnv.ImgBuildConfig.dockerfileLoc)
-
-		dockerBuildContext, err := asgmtEnv.ImgBuildConfig.getDockerBuildContextTar()
+		imageID, err := asgmtEnv.buildImage(ctx, filepath.Base(asgmtEnv.ImgBuildConfig.dockerfileLoc),
+			asgmtEnv.DockerfileInstructions.String(), containers.ImageBuildOptions{
+				Tags:      []string{asgmtEnv.ImgBuildConfig.getImageReference()},
+				Labels:    asgmtEnv.ImgBuildConfig.imageLabels,
+				BuildArgs: asgmtEnv.AsgmtEnvConfig.BuildArgs})
 		if err != nil {
 			return err
 		}
+		asgmtEnv.ImageID = imageID
 
-		response, err := dockerClient.ImageBuild(
-			backgroundContext,
-			dockerBuildContext,
-			types.ImageBuildOptions{
-				Dockerfile: dockerfileLoc,
-				Tags:       []string{asgmtEnv.ImgBuildConfig.imageTag}})
-		if err != nil {
-			return errors.Wrap(err, "error in building docker image")
+		if asgmtEnv.AsgmtEnvConfig.MultiStage.Enabled {
+			return asgmtEnv.reportImageSize(ctx)
 		}
-		defer func() {
-			err := response.Body.Close()
-			if err != nil {
-				log.Println(err)
-				return
+		return nil
+	} else {
+		return asgmtEnv.pullImage(ctx)
+	}
+}
+
+// buildImage builds an image from the Dockerfile with the given name and contents with the given options
+// and returns the ID of the built image. The manifest of the build context is reported in verbose mode.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) buildImage(ctx context.Context, dockerfileName string,
+	dockerfile string, options containers.ImageBuildOptions) (string, error) {
+	buildCtx, err := asgmtEnv.getBuildContext(dockerfileName, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	if asgmtEnv.verbose {
+		for _, line := range buildCtx.getManifest() {
+			if err := asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "build",
+				Message: "Build context: " + line}); err != nil {
+				return "", err
 			}
-		}()
+		}
+	}
+	dockerBuildContext, err := buildCtx.getTar()
+	if err != nil {
+		return "", err
+	}
 
-		_, err = io.Copy(os.Stdout, response.Body)
+	options.Dockerfile = dockerfileName
+	response, err := asgmtEnv.engine.BuildImage(ctx, dockerBuildContext, options)
+	if err != nil {
+		return "", errors.Wrap(err, "error in building docker image")
+	}
+	defer func() {
+		err := response.Close()
 		if err != nil {
-			return errors.Wrap(err, "error in reading image build response")
+			log.Println(err)
+			return
 		}
+	}()
 
-		return err
-	} else {
-		return asgmtEnv.pullImage()
+	result, err := decodeProgress("build", response, asgmtEnv.renderer)
+	if err != nil {
+		return "", errors.Wrap(err, "error in building docker image")
 	}
+	return result.ImageID, nil
 }
 
-// publishImage pushes the built image to docker hub, if required, if it is not already present.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) publishImage() error {
-	if !asgmtEnv.ImageExists && asgmtEnv.ImgBuildConfig.publishImage {
-		backgroundContext := context.Background()
-		dockerClient, err := client.NewEnvClient()
-		if err != nil {
-			return errors.Wrap(err, "error in creating new docker client")
+// getBuildContext returns the build context holding the Dockerfile with the given name and contents and
+// the files of the assets, along with the installation scripts of the languages unless the image is built
+// from the language image.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getBuildContext(dockerfileName string, dockerfile string) (*buildContext, error) {
+	buildCtx := newBuildContext()
+	if !asgmtEnv.LanguageImageExists {
+		if err := buildCtx.addScripts(getReferencedScripts(asgmtEnv.AsgmtEnvConfig)); err != nil {
+			return nil, err
 		}
+	}
+	if err := buildCtx.addAssets(asgmtEnv.assets); err != nil {
+		return nil, err
+	}
+	if err := buildCtx.add(dockerfileName, []byte(dockerfile), 0644); err != nil {
+		return nil, err
+	}
+	return buildCtx, nil
+}
 
-		authConfig := types.AuthConfig{
-			Username: asgmtEnv.ImgBuildConfig.authData.Username,
-			Password: asgmtEnv.ImgBuildConfig.authData.Password,
-		}
-		authJson, err := json.Marshal(authConfig)
-		if err != nil {
-			return errors.Wrap(err, "error in encoding authConfig")
+// getBuildStageSize builds the build stage of a multi-stage build on its own, under a temporary tag,
+// and returns the size of the resulting image, i.e the size of the image built in a single stage.
+// The layers of the build stage are cached, so that they are not built again by the full build.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getBuildStageSize(ctx context.Context) (int64, error) {
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference() + buildStageTagSuffix
+	_, err := asgmtEnv.buildImage(ctx, filepath.Base(asgmtEnv.ImgBuildConfig.dockerfileLoc),
+		asgmtEnv.BuildStageInstructions.String(), containers.ImageBuildOptions{Tags: []string{imageRef},
+			BuildArgs: asgmtEnv.AsgmtEnvConfig.BuildArgs})
+	if err != nil {
+		return 0, errors.Wrap(err, "error in building build stage")
+	}
+	// The build stage is only kept in the cache of the container engine.
+	defer func() {
+		if err := asgmtEnv.engine.RemoveImage(context.Background(), imageRef); err != nil {
+			log.Println("error while removing the build stage image", err)
 		}
+	}()
 
-		authString := base64.URLEncoding.EncodeToString(authJson)
+	info, err := asgmtEnv.engine.InspectImage(ctx, imageRef)
+	if err != nil {
+		return 0, errors.Wrap(err, "error in inspecting build stage")
+	}
+	return info.Size, nil
+}
 
-		imageString := fmt.Sprintf("%s/%s", constants.DockerIO, asgmtEnv.ImgBuildConfig.imageTag)
+// reportImageSize records the size of the image built in multiple stages and reports
+// it along with the size of the image built in a single stage.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) reportImageSize(ctx context.Context) error {
+	info, err := asgmtEnv.engine.InspectImage(ctx, asgmtEnv.ImgBuildConfig.getImageReference())
+	if err != nil {
+		return errors.Wrap(err, "error in inspecting docker image")
+	}
+	asgmtEnv.ImageSize = info.Size
 
-		response, err := dockerClient.ImagePush(backgroundContext, imageString, types.ImagePushOptions{
-			RegistryAuth: authString,
-		})
+	comparison := "no smaller"
+	if asgmtEnv.SingleStageSize > 0 && asgmtEnv.ImageSize < asgmtEnv.SingleStageSize {
+		comparison = fmt.Sprintf("%d%% smaller",
+			(asgmtEnv.SingleStageSize-asgmtEnv.ImageSize)*100/asgmtEnv.SingleStageSize)
+	}
+	return asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "build",
+		Message: fmt.Sprintf("Image size %s in a single stage, %s in multiple stages (%s)",
+			formatSize(asgmtEnv.SingleStageSize), formatSize(asgmtEnv.ImageSize), comparison)})
+}
+
+// publishImage pushes the built image to the registry, if required, if it is not already present.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) publishImage(ctx context.Context) error {
+	if !asgmtEnv.ImageExists && asgmtEnv.ImgBuildConfig.publishImage {
+		authString, err := asgmtEnv.ImgBuildConfig.authData.encode()
 		if err != nil {
-			return errors.Wrap(err, "error in pushing image to hub")
+			return err
 		}
-		_, err = io.Copy(os.Stdout, response)
+
+		imageString := asgmtEnv.ImgBuildConfig.getImageReference()
+
+		response, err := asgmtEnv.engine.PushImage(ctx, imageString, authString)
 		if err != nil {
-			return errors.Wrap(err, "error in reading image push response")
+			return errors.Wrap(err, "error in pushing image to registry")
 		}
 		defer func() {
 			err = response.Close()
@@ -286,39 +553,27 @@ func (asgmtEnv *assignmentEnvironmentImageBuilder) publishImage() error {
 				return
 			}
 		}()
+		result, err := decodeProgress("push", response, asgmtEnv.renderer)
+		if err != nil {
+			return errors.Wrap(err, "error in pushing image to registry")
+		}
+		asgmtEnv.ImageDigest = result.Digest
 	}
 	return nil
 }
 
 // pullImage pulls the required docker image for given assignment environment
-// from docker hub.
-func (asgmtEnv *assignmentEnvironmentImageBuilder) pullImage() error {
-	backgroundContext := context.Background()
-	dockerClient, err := client.NewEnvClient()
+// from the registry.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) pullImage(ctx context.Context) error {
+	authString, err := asgmtEnv.ImgBuildConfig.authData.encode()
 	if err != nil {
-		return errors.Wrap(err, "error in creating new docker client")
-	}
-	authConfig := types.AuthConfig{
-		Username: asgmtEnv.ImgBuildConfig.authData.Username,
-		Password: asgmtEnv.ImgBuildConfig.authData.Password,
-	}
-	authJson, err := json.Marshal(authConfig)
-	if err != nil {
-		return errors.Wrap(err, "error in encoding authConfig")
+		return err
 	}
 
-	authString := base64.URLEncoding.EncodeToString(authJson)
-	imageString := fmt.Sprintf("%s/%s", constants.DockerIO, asgmtEnv.ImgBuildConfig.imageTag)
-	response, err := dockerClient.ImagePull(backgroundContext, imageString, types.ImagePullOptions{
-		RegistryAuth: authString,
-	})
-
-	if err != nil {
-		return errors.Wrap(err, "error in pulling image from hub")
-	}
-	_, err = io.Copy(os.Stdout, response)
+	imageString := asgmtEnv.ImgBuildConfig.getImageReference()
+	response, err := asgmtEnv.engine.PullImage(ctx, imageString, authString)
 	if err != nil {
-		return errors.Wrap(err, "error in reading image pull response")
+		return errors.Wrap(err, "error in pulling image from registry")
 	}
 	defer func() {
 		err = response.Close()
@@ -327,15 +582,19 @@ func (asgmtEnv *assignmentEnvironmentImageBuilder) pullImage() error {
 			return
 		}
 	}()
-
+	result, err := decodeProgress("pull", response, asgmtEnv.renderer)
+	if err != nil {
+		return errors.Wrap(err, "error in pulling image from registry")
+	}
+	asgmtEnv.ImageDigest = result.Digest
 	return nil
-
 }
 
 // resetDockerfileData resets the Dockerfile instructions buffer.
 func (asgmtEnv *assignmentEnvironmentImageBuilder) resetDockerfileData() {
 	// Clear the Dockerfile data.
 	asgmtEnv.DockerfileInstructions.Reset()
+	asgmtEnv.BuildStageInstructions.Reset()
 }
 
 // deleteDockerfile deletes the dockerfile that was created
@@ -350,16 +609,34 @@ func (asgmtEnv *assignmentEnvironmentImageBuilder) deleteDockerfile() error {
 }
 
 // undoBuild removes the assignment environment image that was built locally.
+// The undo runs after the execution has been cancelled as well,
+// so it is not bound to the context of the execution.
 func (asgmtEnv *assignmentEnvironmentImageBuilder) undoBuild() error {
 	// Delete the built image.
-	backgroundContext := context.Background()
-	dockerClient, err := client.NewEnvClient()
-	if err != nil {
+	if err := asgmtEnv.engine.RemoveImage(context.Background(), asgmtEnv.ImgBuildConfig.getImageReference()); err != nil {
 		return err
 	}
+	asgmtEnv.ImageID = ""
+	return nil
+}
 
-	_, err = dockerClient.ImageRemove(backgroundContext, asgmtEnv.ImgBuildConfig.imageTag, types.ImageRemoveOptions{
-		Force: true})
+// runPhase runs the function of the given phase with the context bounded by the timeout
+// of the phase, if any. The timeouts given as options take precedence over the configuration.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) runPhase(ctx context.Context, phase string,
+	run func(ctx context.Context) error) error {
+	timeout := asgmtEnv.timeouts.GetTimeout(phase)
+	if timeout == 0 {
+		timeout = asgmtEnv.AsgmtEnvConfig.Timeouts.GetTimeout(phase)
+	}
+	if timeout == 0 {
+		return run(ctx)
+	}
 
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := run(phaseCtx)
+	if err != nil && ctx.Err() == nil && phaseCtx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "%s phase timed out after %s", phase, timeout)
+	}
 	return err
 }
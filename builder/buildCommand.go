@@ -3,7 +3,9 @@
 package builder
 
 import (
+	"context"
 	"github.com/pkg/errors"
+	"path/filepath"
 )
 
 // buildCommand struct type holds assignmentEnvironmentImageBuilder instance
@@ -13,15 +15,48 @@ type buildCommand struct {
 }
 
 // execute invokes the build function to build the docker image.
-func (cmd *buildCommand) execute() error {
-	return cmd.asgmtEnv.build()
+func (cmd *buildCommand) execute(ctx context.Context) error {
+	return cmd.asgmtEnv.runPhase(ctx, "build", cmd.asgmtEnv.build)
 }
 
 // undo invokes the deleteDockerfile function to delete the created
-// dockerfile if any error is encountered while building the image.
+// dockerfile if any error is encountered while building the image,
+// and removes the image if it has been built but not removed yet.
 func (cmd *buildCommand) undo() error {
 	if err := cmd.asgmtEnv.deleteDockerfile(); err != nil {
 		return errors.Wrap(err, "error in undo build operation")
 	}
+	if cmd.asgmtEnv.ImageID != "" {
+		if err := cmd.asgmtEnv.undoBuild(); err != nil {
+			return errors.Wrap(err, "error in undo build operation")
+		}
+	}
 	return nil
 }
+
+// plan reports the build context and the image that would be built,
+// or the language image that would be pulled if it is the image of the configuration.
+func (cmd *buildCommand) plan(ctx context.Context, plan *Plan) error {
+	imageRef := cmd.asgmtEnv.ImgBuildConfig.getImageReference()
+	if cmd.asgmtEnv.ImageExists {
+		plan.addAction("build", "pull existing language image %s", cmd.asgmtEnv.LanguageImageRef)
+		return nil
+	}
+	buildCtx, err := cmd.asgmtEnv.getBuildContext(filepath.Base(cmd.asgmtEnv.ImgBuildConfig.dockerfileLoc),
+		cmd.asgmtEnv.DockerfileInstructions.String())
+	if err != nil {
+		return err
+	}
+	plan.BuildContext = buildCtx.getNames()
+	if cmd.asgmtEnv.AsgmtEnvConfig.MultiStage.Enabled {
+		plan.addAction("build", "build image %s in multiple stages from %s", imageRef, cmd.asgmtEnv.getBuildSource())
+		return nil
+	}
+	plan.addAction("build", "build image %s from %s", imageRef, cmd.asgmtEnv.getBuildSource())
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *buildCommand) phase() string {
+	return "build"
+}
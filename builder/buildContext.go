@@ -0,0 +1,145 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"archive/tar"
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/constants"
+	"assignment-exec/image-builder/scripts"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// buildContextEntry struct type holds a file of the build context,
+// i.e its path within the build context, its contents and its mode.
+type buildContextEntry struct {
+	Name    string
+	Content []byte
+	Mode    os.FileMode
+}
+
+// buildContext struct type holds the files sent to the container engine to build an image,
+// which are only the Dockerfile and the files that the Dockerfile copies into the image.
+type buildContext struct {
+	entries map[string]buildContextEntry
+}
+
+// newBuildContext creates an empty build context.
+func newBuildContext() *buildContext {
+	return &buildContext{entries: make(map[string]buildContextEntry)}
+}
+
+// add adds the file with the given path, contents and mode to the build context.
+// It returns error if the build context already holds a file with the path.
+func (buildCtx *buildContext) add(name string, content []byte, mode os.FileMode) error {
+	if _, found := buildCtx.entries[name]; found {
+		return errors.Errorf("build context already holds %s", name)
+	}
+	buildCtx.entries[name] = buildContextEntry{Name: name, Content: content, Mode: mode}
+	return nil
+}
+
+// getEntries returns the files of the build context in the sorted order of their paths.
+func (buildCtx *buildContext) getEntries() []buildContextEntry {
+	entries := make([]buildContextEntry, 0, len(buildCtx.entries))
+	for _, entry := range buildCtx.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// getNames returns the paths of the files of the build context in sorted order.
+func (buildCtx *buildContext) getNames() []string {
+	var names []string
+	for _, entry := range buildCtx.getEntries() {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+// getManifest returns a line for every file of the build context,
+// giving its mode, its size and its path.
+func (buildCtx *buildContext) getManifest() []string {
+	var manifest []string
+	for _, entry := range buildCtx.getEntries() {
+		manifest = append(manifest, fmt.Sprintf("%s %8s  %s", entry.Mode, formatSize(int64(len(entry.Content))), entry.Name))
+	}
+	return manifest
+}
+
+// getTar returns the build context as an in-memory tar, so that nothing is written to the disk.
+// The files are added in sorted order and without modification time, so that the same build
+// context always produces the same tar and does not invalidate the build cache of the image.
+func (buildCtx *buildContext) getTar() (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	for _, entry := range buildCtx.getEntries() {
+		header := &tar.Header{Name: entry.Name, Mode: int64(entry.Mode), Size: int64(len(entry.Content))}
+		if err := writer.WriteHeader(header); err != nil {
+			return nil, errors.Wrapf(err, "error in adding %s to build context tar", entry.Name)
+		}
+		if _, err := writer.Write(entry.Content); err != nil {
+			return nil, errors.Wrapf(err, "error in adding %s to build context tar", entry.Name)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "error in creating build context tar")
+	}
+	return buf, nil
+}
+
+// addScripts adds the installation scripts to the scripts directory of the build context.
+func (buildCtx *buildContext) addScripts(installationScripts []scripts.Script) error {
+	for _, script := range installationScripts {
+		if err := buildCtx.add(path.Join(constants.InstallationScriptsDir, script.Name), script.Content, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAssets adds the files of the assets to the assets directory of the build context, with the mode of
+// their asset. The files are read from the disk, and must still match the checksums of the assets.
+func (buildCtx *buildContext) addAssets(assets []configurations.ResolvedAsset) error {
+	for _, asset := range assets {
+		for _, file := range asset.Files {
+			content, err := ioutil.ReadFile(file.Path)
+			if err != nil {
+				return errors.Wrapf(err, "error in reading asset %s", file.Source)
+			}
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != file.Checksum {
+				return errors.Errorf("asset %s changed since the configuration was verified", file.Source)
+			}
+			if err := buildCtx.add(getAssetContextPath(file), content, asset.GetMode()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getAssetContextPath returns the path of the asset file within the build context.
+func getAssetContextPath(file configurations.AssetFile) string {
+	return path.Join(constants.AssetsDir, file.Source)
+}
+
+// getReferencedScripts returns the installation script of every language of the configuration,
+// which are the only scripts that the Dockerfile copies and runs.
+func getReferencedScripts(config *configurations.AssignmentEnvConfig) []scripts.Script {
+	var referenced []scripts.Script
+	for _, lang := range config.Deps.Languages {
+		if script, found := scripts.Default().Get(lang.Name, lang.Version); found {
+			referenced = append(referenced, script)
+		}
+	}
+	return referenced
+}
@@ -3,17 +3,26 @@
 package builder
 
 import (
+	"assignment-exec/image-builder/builder/containers"
 	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/history"
+	"assignment-exec/image-builder/registry"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"io"
 	"log"
 )
 
 // BuildManager struct type holds array of commands to execute
-// and a stack for commands to perform the corresponding undo.
+// and a stack for commands to perform the corresponding undo, along with
+// the assignment environment the commands work on, if any, and the store
+// recording every execution, if any.
 type BuildManager struct {
 	commands     []command
 	undoCommands *stack
+	asgmtEnv     *assignmentEnvironmentImageBuilder
+	history      *history.Store
 }
 
 // BuildManagerOption represents options that can be used to help initialize
@@ -36,30 +45,157 @@ func NewBuildManager(options ...BuildManagerOption) (*BuildManager, error) {
 }
 
 // WithCommands returns a BuildManagerOption for initializing the commands.
-func WithCommands(asgmtEnv *assignmentEnvironmentImageBuilder) BuildManagerOption {
+func WithCommands(asgmtEnv *assignmentEnvironmentImageBuilder, writer io.Writer) BuildManagerOption {
 	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
 
 		var commandList []command
 		commandList = append(commandList,
-			&verifyCommand{asgmtEnv: asgmtEnv},
+			&verifyCommand{asgmtEnv: asgmtEnv, writeEnvLock: true},
 			&writeDockerfileCommand{asgmtEnv: asgmtEnv},
 			&buildCommand{asgmtEnv: asgmtEnv},
-			&publishCommand{asgmtEnv: asgmtEnv})
+			&smokeTestCommand{asgmtEnv: asgmtEnv},
+			&codeRunnerCheckCommand{asgmtEnv: asgmtEnv},
+			&publishCommand{asgmtEnv: asgmtEnv, writer: writer})
 
 		b.commands = commandList
 		return nil
 	}
 }
 
-// ExecuteCommands invokes execute function for all commands sequentially.
-// If error is encountered in any command execution then perform undo operations in
-// the reverse order of execution.
-func (builder *BuildManager) ExecuteCommands() error {
+// WithValidateCommands returns a BuildManagerOption for initializing the commands
+// to only verify the configuration against the registry.
+func WithValidateCommands(asgmtEnv *assignmentEnvironmentImageBuilder) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{&verifyCommand{asgmtEnv: asgmtEnv}}
+		return nil
+	}
+}
+
+// WithUpdateCommands returns a BuildManagerOption for initializing the commands
+// to verify the configuration and write the resolved digests to its lock file.
+func WithUpdateCommands(asgmtEnv *assignmentEnvironmentImageBuilder) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{&verifyCommand{asgmtEnv: asgmtEnv, writeEnvLock: true}}
+		return nil
+	}
+}
+
+// WithRenderCommands returns a BuildManagerOption for initializing the commands
+// to verify the configuration and render the dockerfile to the writer without building it.
+func WithRenderCommands(asgmtEnv *assignmentEnvironmentImageBuilder, writer io.Writer) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{
+			&verifyCommand{asgmtEnv: asgmtEnv},
+			&renderCommand{asgmtEnv: asgmtEnv, writer: writer}}
+		return nil
+	}
+}
+
+// WithBuildCommands returns a BuildManagerOption for initializing the commands
+// to verify the configuration, write the dockerfile, build the image, run its
+// smoke checks and check its code-runner without publishing it.
+func WithBuildCommands(asgmtEnv *assignmentEnvironmentImageBuilder) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{
+			&verifyCommand{asgmtEnv: asgmtEnv, writeEnvLock: true},
+			&writeDockerfileCommand{asgmtEnv: asgmtEnv},
+			&buildCommand{asgmtEnv: asgmtEnv},
+			&smokeTestCommand{asgmtEnv: asgmtEnv},
+			&codeRunnerCheckCommand{asgmtEnv: asgmtEnv}}
+		return nil
+	}
+}
+
+// WithPublishCommands returns a BuildManagerOption for initializing the commands
+// to verify the configuration and publish the existing local image.
+// The local image is kept if the publish fails.
+func WithPublishCommands(asgmtEnv *assignmentEnvironmentImageBuilder, writer io.Writer) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{
+			&verifyCommand{asgmtEnv: asgmtEnv},
+			&publishCommand{asgmtEnv: asgmtEnv, writer: writer, keepImage: true}}
+		return nil
+	}
+}
+
+// WithInspectCommands returns a BuildManagerOption for initializing the commands
+// to verify the configuration and report the details of the image to the writer.
+func WithInspectCommands(asgmtEnv *assignmentEnvironmentImageBuilder, writer io.Writer) BuildManagerOption {
+	return func(b *BuildManager) error {
+		b.asgmtEnv = asgmtEnv
+		b.commands = []command{
+			&verifyCommand{asgmtEnv: asgmtEnv},
+			&inspectCommand{asgmtEnv: asgmtEnv, writer: writer}}
+		return nil
+	}
+}
+
+// WithCleanCommands returns a BuildManagerOption for initializing the commands
+// to remove the local images created by the image builder from the engine.
+func WithCleanCommands(engine containers.ContainerEngine, writer io.Writer) BuildManagerOption {
+	return func(b *BuildManager) error {
+		if engine == nil {
+			return errors.New("container engine not provided")
+		}
+		b.commands = []command{&cleanCommand{engine: engine, writer: writer}}
+		return nil
+	}
+}
+
+// WithHistory returns a BuildManagerOption for initializing the store
+// in which every execution of the commands is recorded.
+func WithHistory(store *history.Store) BuildManagerOption {
+	return func(b *BuildManager) error {
+		if store == nil {
+			return errors.New("history store not provided")
+		}
+		b.history = store
+		return nil
+	}
+}
+
+// ExecuteCommands invokes execute function for all commands sequentially with the given context.
+// If error is encountered in any command execution, or the context is cancelled,
+// then perform undo operations in the reverse order of execution.
+// The execution is recorded in the history store, if any.
+func (builder *BuildManager) ExecuteCommands(ctx context.Context) error {
+	record := history.NewRecord()
+	err := builder.executeCommands(ctx, record)
+	record.Finish(err)
+
+	if builder.history != nil {
+		if saveErr := builder.history.Save(record); saveErr != nil {
+			// Logs the error encountered while recording the execution, which does not fail it.
+			log.Printf("error in recording execution: %v", saveErr)
+		}
+	}
+	return err
+}
+
+// executeCommands executes the commands and undoes them upon error,
+// recording the executed phases and the undo steps.
+func (builder *BuildManager) executeCommands(ctx context.Context, record *history.Record) error {
 	for _, cmd := range builder.commands {
-		builder.undoCommands.push(cmd)
+		err := ctx.Err()
+		if err != nil {
+			err = errors.Wrap(err, "execution of commands interrupted")
+		} else {
+			builder.undoCommands.push(cmd)
+			record.StartPhase(cmd.phase())
+			err = cmd.execute(ctx)
+			record.EndPhase(err)
+		}
 
-		if err := cmd.execute(); err != nil {
-			if undoErr := builder.UndoCommands(); undoErr != nil {
+		if err != nil {
+			// The details are recorded before the undo resets them.
+			builder.describe(record)
+			if undoErr := builder.recordUndoCommands(record); undoErr != nil {
 				// Logs the error encountered during undoing command execution.
 				log.Printf("error in undoing operations: %v", undoErr)
 			}
@@ -67,40 +203,116 @@ func (builder *BuildManager) ExecuteCommands() error {
 			return err
 		}
 	}
+	builder.describe(record)
 	return nil
 }
 
+// describe records the configuration digest, the dockerfile and the image
+// of the assignment environment that the commands work on, if any.
+func (builder *BuildManager) describe(record *history.Record) {
+	asgmtEnv := builder.asgmtEnv
+	if asgmtEnv == nil {
+		return
+	}
+	if digest, err := asgmtEnv.AsgmtEnvConfig.GetDigest(); err == nil {
+		record.ConfigDigest = digest
+	}
+	record.Dockerfile = asgmtEnv.DockerfileInstructions.String()
+	record.Image = asgmtEnv.GetImageReference()
+	record.ImageID = asgmtEnv.ImageID
+	record.ImageDigest = asgmtEnv.ImageDigest
+}
+
+// PlanCommands invokes plan function for all commands sequentially with the given context,
+// so that each command reports its intended effect without performing it.
+// It returns the resulting plan, or the first error encountered while planning.
+func (builder *BuildManager) PlanCommands(ctx context.Context) (*Plan, error) {
+	plan := &Plan{}
+	for _, cmd := range builder.commands {
+		if err := cmd.plan(ctx, plan); err != nil {
+			return nil, errors.Wrap(err, "error in planning commands")
+		}
+	}
+	return plan, nil
+}
+
 // UndoCommands pops the all commands from stack and invokes its
 // respective undo function.
 func (builder *BuildManager) UndoCommands() error {
+	return builder.recordUndoCommands(nil)
+}
 
+// recordUndoCommands undoes the commands, recording every undo step in the record, if any.
+func (builder *BuildManager) recordUndoCommands(record *history.Record) error {
 	for !builder.undoCommands.isEmpty() {
 		undoCmd := builder.undoCommands.pop()
-		if err := undoCmd.undo(); err != nil {
+		err := undoCmd.undo()
+		if record != nil {
+			record.AddUndoStep(undoCmd.phase(), err)
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// GetConfigurations takes image publishImage flag, assignment environment configuration file path
-// and dockerfile location, reads the config file, sets the imageBuildConfig instance,
-// sets the assignmentEnvironmentImageBuilder instance.
-func GetConfigurations(publishImage bool, configFilepath string, dockerfileLoc string) (*assignmentEnvironmentImageBuilder, error) {
+// GetConfigurations takes image publishImage flag, registry, assignment environment configuration file path,
+// dockerfile location and any additional assignmentEnvironmentImageBuilder options, reads the config file,
+// sets the imageBuildConfig instance, sets the assignmentEnvironmentImageBuilder instance.
+// The given registry, if not empty, overrides the registry in the configuration file.
+// The base image and language image are pinned by the lock file next to the config file,
+// which is written once they are first resolved by a build or an update.
+func GetConfigurations(publishImage bool, registryHost string, configFilepath string, dockerfileLoc string,
+	options ...assignmentEnvironmentImageBuilderOption) (*assignmentEnvironmentImageBuilder, error) {
 	config, err := configurations.GetAssignmentEnvConfig(configFilepath)
 	if err != nil {
 		return nil, err
 	}
-	authData, err := getAuthData()
+	// The lock file next to the config file pins the base image and language image by digest.
+	options = append([]assignmentEnvironmentImageBuilderOption{
+		withEnvLockFilepath(configurations.GetEnvLockFilepath(configFilepath))}, options...)
+	return NewConfigurations(publishImage, registryHost, config, dockerfileLoc, options...)
+}
+
+// NewConfigurations sets the imageBuildConfig instance and the assignmentEnvironmentImageBuilder
+// instance for the given configuration, in the same way as GetConfigurations for a config file.
+func NewConfigurations(publishImage bool, registryHost string, config *configurations.AssignmentEnvConfig,
+	dockerfileLoc string, options ...assignmentEnvironmentImageBuilderOption) (*assignmentEnvironmentImageBuilder, error) {
+	if registryHost == "" {
+		registryHost = config.Registry
+	}
+	registryHost = registry.NormalizeRegistry(registryHost)
+
+	authData, err := getAuthData(registryHost)
 	if err != nil {
 		return nil, errors.Wrap(err, "error while getting docker authentication data")
 	}
 
-	imageTag := fmt.Sprintf("%s/%s%s", authData.Username,
-		config.Deps.Language.Name, config.Deps.Language.Version)
+	// Credentials are used for the registry of the base image as well, if stored for it.
+	registryClientOptions := []registry.ClientOption{
+		registry.WithCredentials(registryHost, authData.Username, authData.Password)}
+	baseImageRegistry := registry.ParseReference(config.BaseImage).Registry
+	if baseImageRegistry != registryHost {
+		baseImageAuthData, err := getDockerConfigAuthData(baseImageRegistry)
+		if err != nil {
+			return nil, errors.Wrap(err, "error while getting docker authentication data")
+		}
+		if baseImageAuthData != nil {
+			registryClientOptions = append(registryClientOptions, registry.WithCredentials(baseImageRegistry,
+				baseImageAuthData.Username, baseImageAuthData.Password))
+		}
+	}
+	registryClient, err := registry.NewClient(registryClientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in creating registry client")
+	}
+
+	imageTag := fmt.Sprintf("%s/%s", authData.Username, config.Deps.GetLanguagesTag())
 
 	imgBuilder, err := newImageBuildConfig(
 		withDockerAuthData(authData),
+		withRegistry(registryHost),
 		withImageTag(imageTag),
 		withDockerfileLocation(dockerfileLoc),
 		withPublishImageFlag(publishImage))
@@ -109,9 +321,11 @@ func GetConfigurations(publishImage bool, configFilepath string, dockerfileLoc s
 		return nil, errors.Wrap(err, "error in creating image builder instance for assignment env")
 	}
 
-	asgmtEnv, err := newAssignmentEnvironmentImageBuilder(
+	options = append([]assignmentEnvironmentImageBuilderOption{
 		withImageBuildCfg(imgBuilder),
-		withAsgmtEnvConfig(config))
+		withAsgmtEnvConfig(config),
+		withRegistryClient(registryClient)}, options...)
+	asgmtEnv, err := newAssignmentEnvironmentImageBuilder(options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error in creating assignment env instance")
 	}
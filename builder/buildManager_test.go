@@ -0,0 +1,516 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/builder/fake"
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/environment"
+	"assignment-exec/image-builder/history"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEnvironment struct type holds the fake engine, the registry it serves,
+// and the config file and dockerfile locations in a temporary directory.
+type fakeEnvironment struct {
+	engine        *fake.Engine
+	registry      string
+	configFile    string
+	dockerfileLoc string
+}
+
+// setupFakeEnvironment changes to the repository root, sets the docker authentication
+// environment variables and starts a fake engine whose registry holds the code-runner base image.
+func setupFakeEnvironment(t *testing.T) (*fakeEnvironment, func()) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(".."))
+	assert.NoError(t, os.Setenv(environment.DockerAuthUsername, "assignmentexec"))
+	assert.NoError(t, os.Setenv(environment.DockerAuthPassword, "password"))
+
+	tempDir, err := ioutil.TempDir("", "image-builder")
+	assert.NoError(t, err)
+
+	engine := fake.NewEngine()
+	engine.RemoteImages["assignmentexec/code-runner:1.0"] = &containers.ImageInfo{ID: "sha256:code-runner"}
+	server := httptest.NewServer(engine.RegistryHandler())
+	registryHost := server.Listener.Addr().String()
+
+	configFile := filepath.Join(tempDir, "assignment-env.yaml")
+	config := fmt.Sprintf("baseImage: %s/assignmentexec/code-runner:1.0\nregistry: %s\n"+
+		"dependencies:\n  lang: gcc\n  langVersion: 7\n", registryHost, registryHost)
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(config), 0644))
+
+	env := &fakeEnvironment{
+		engine:        engine,
+		registry:      registryHost,
+		configFile:    configFile,
+		dockerfileLoc: filepath.Join(tempDir, "Dockerfile"),
+	}
+	return env, func() {
+		server.Close()
+		assert.NoError(t, os.RemoveAll(tempDir))
+		assert.NoError(t, os.Chdir(workDir))
+	}
+}
+
+// TestExecuteCommandsWithFakeEngine tests the verify, write, build and publish
+// pipeline against the in-memory container engine.
+func TestExecuteCommandsWithFakeEngine(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	var output bytes.Buffer
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, &output))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	assert.True(t, strings.HasPrefix(imageRef, env.registry+"/assignmentexec/gcc7-"))
+	assert.Equal(t, imageRef+"@"+asgmtEnv.ImageDigest+"\n", output.String())
+	imageKey := fake.ImageKey(imageRef)
+	assert.Contains(t, env.engine.LocalImages, imageKey)
+	assert.Contains(t, env.engine.RemoteImages, imageKey)
+	assert.True(t, strings.HasPrefix(env.engine.Dockerfiles[imageKey], asgmtEnv.DockerfileInstructions.String()))
+	assert.Equal(t, "gcc 7", env.engine.LocalImages[imageKey].Labels["org.assignment-exec.language"])
+	assert.Equal(t, "passed", env.engine.LocalImages[imageKey].Labels["org.assignment-exec.code-runner-check"])
+	assert.Equal(t, "52453", env.engine.LocalImages[imageKey].Labels["org.assignment-exec.code-runner-port"])
+	assert.Contains(t, env.engine.Calls, "StartContainer "+imageRef+" -port 52453")
+	assert.Equal(t, env.engine.RemoteImages[imageKey].ID, asgmtEnv.ImageDigest)
+}
+
+// TestVerifyTwiceAfterPublish tests that verifying twice, e.g planning the commands and then
+// executing them, once the image is published still builds from the base image rather than
+// taking the published image for the language image.
+func TestVerifyTwiceAfterPublish(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	dockerfile := asgmtEnv.DockerfileInstructions.String()
+	assert.Contains(t, env.engine.RemoteImages, fake.ImageKey(imageRef))
+
+	// Without the lock file the language image is resolved in the registry.
+	assert.NoError(t, os.Remove(configurations.GetEnvLockFilepath(env.configFile)))
+	asgmtEnv, err = GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, asgmtEnv.verifyAndWriteInstructions(context.Background()))
+		assert.Equal(t, imageRef, asgmtEnv.ImgBuildConfig.getImageReference())
+		assert.False(t, asgmtEnv.LanguageImageExists)
+		assert.Equal(t, dockerfile, asgmtEnv.DockerfileInstructions.String())
+	}
+}
+
+// TestExecuteCommandsBuildContext tests that the build context holds only the Dockerfile and the
+// installation scripts of the languages, and that its manifest is reported in verbose mode.
+func TestExecuteCommandsBuildContext(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	output := &bytes.Buffer{}
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine),
+		WithProgressRenderer(&plainRenderer{writer: output}), WithVerbose(true))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithBuildCommands(asgmtEnv))
+	assert.NoError(t, err)
+	// The image is not labelled by the code-runner check, which builds it again from another build context.
+	buildManager.commands = buildManager.commands[:3]
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageKey := fake.ImageKey(asgmtEnv.ImgBuildConfig.getImageReference())
+	assert.Equal(t, []string{"Dockerfile", "scripts/gcc_7.sh"}, env.engine.BuildContexts[imageKey])
+	assert.Contains(t, asgmtEnv.DockerfileInstructions.String(), "COPY scripts/gcc_7.sh /code-runner/scripts/\n")
+	assert.Regexp(t, `\[build\] Build context: -rwxr-xr-x +[0-9.]+k?B  scripts/gcc_7.sh\n`, output.String())
+	assert.Regexp(t, `\[build\] Build context: -rw-r--r-- +[0-9.]+k?B  Dockerfile\n`, output.String())
+}
+
+// TestExecuteCommandsAssets tests that the files of the assets are added to the build
+// context and copied into the image after the languages are installed.
+func TestExecuteCommandsAssets(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	configDir := filepath.Dir(env.configFile)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(configDir, "grader.py"), []byte("print()"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(configDir, "test.h"), []byte("#pragma once"), 0644))
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config, "assets:\n"+
+		"  - source: grader.py\n    destination: /opt/grader.py\n    mode: \"0755\"\n    owner: runner\n"+
+		"  - source: \"*.h\"\n    destination: /usr/include/\n"...), 0644))
+
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithBuildCommands(asgmtEnv))
+	assert.NoError(t, err)
+	// The image is not labelled by the code-runner check, which builds it again from another build context.
+	buildManager.commands = buildManager.commands[:3]
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageKey := fake.ImageKey(asgmtEnv.ImgBuildConfig.getImageReference())
+	assert.Equal(t, []string{"Dockerfile", "assets/grader.py", "assets/test.h", "scripts/gcc_7.sh"},
+		env.engine.BuildContexts[imageKey])
+	assert.True(t, strings.HasSuffix(asgmtEnv.DockerfileInstructions.String(), "ENV SUPPORTED_LANGUAGE=gcc\n"+
+		"COPY --chown=runner assets/grader.py /opt/grader.py\nCOPY assets/test.h /usr/include/\n"))
+}
+
+// TestExecuteCommandsEnv tests that the build arguments are declared after the base image and given
+// to the container engine, and that the environment and working directory are set after the languages.
+func TestExecuteCommandsEnv(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config, "env:\n  LANG: C.UTF-8\n  CC: gcc\n"+
+		"buildArgs:\n  APT_MIRROR: http://mirror.example.com\nworkdir: /home/runner\n"...), 0644))
+
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithBuildCommands(asgmtEnv))
+	assert.NoError(t, err)
+	buildManager.commands = buildManager.commands[:3]
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageKey := fake.ImageKey(asgmtEnv.ImgBuildConfig.getImageReference())
+	assert.Equal(t, map[string]string{"APT_MIRROR": "http://mirror.example.com"}, env.engine.BuildArgs[imageKey])
+	dockerfile := asgmtEnv.DockerfileInstructions.String()
+	assert.Regexp(t, "^FROM [^\n]+\nARG APT_MIRROR\n", dockerfile)
+	assert.True(t, strings.HasSuffix(dockerfile, "ENV SUPPORTED_LANGUAGE=gcc\n"+
+		"ENV CC=gcc LANG=C.UTF-8\nWORKDIR /home/runner\n"))
+}
+
+// TestExecuteCommandsMultiStage tests that an image built in multiple stages holds only
+// the final stage, and that its size is reported along with the size of its build stage.
+func TestExecuteCommandsMultiStage(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config, "multiStage:\n  enabled: true\n"...), 0644))
+
+	output := &bytes.Buffer{}
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: output}))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	imageKey := fake.ImageKey(imageRef)
+	assert.Contains(t, asgmtEnv.DockerfileInstructions.String(), "COPY --from=build /usr/bin/gcc-7 /usr/bin/gcc-7\n")
+	assert.NotContains(t, asgmtEnv.DockerfileInstructions.String(), "/usr/include")
+	assert.NotContains(t, env.engine.Dockerfiles[imageKey], "./scripts/gcc_7.sh")
+	assert.Equal(t, env.engine.GetSize(fake.GetLastStage(asgmtEnv.DockerfileInstructions.String())), asgmtEnv.ImageSize)
+	assert.Equal(t, env.engine.GetSize(asgmtEnv.BuildStageInstructions.String()), asgmtEnv.SingleStageSize)
+	assert.Contains(t, env.engine.Calls, "BuildImage "+imageRef+buildStageTagSuffix)
+	assert.NotContains(t, env.engine.LocalImages, imageKey+buildStageTagSuffix)
+	assert.Contains(t, output.String(), fmt.Sprintf("Image size %s in a single stage, %s in multiple stages",
+		formatSize(asgmtEnv.SingleStageSize), formatSize(asgmtEnv.ImageSize)))
+}
+
+// TestExecuteCommandsMultiStageSmokeTest tests that the smoke checks run against the final stage of
+// an image built in multiple stages, which installs the runtime packages and the libraries again.
+func TestExecuteCommandsMultiStageSmokeTest(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config,
+		"  lib:\n    zlib1g-dev:\n      manager: apt\nmultiStage:\n  enabled: true\n"...), 0644))
+
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithBuildCommands(asgmtEnv))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	finalStage := fake.GetLastStage(asgmtEnv.DockerfileInstructions.String())
+	assert.Contains(t, finalStage, "--no-install-recommends binutils libc6-dev ")
+	assert.Contains(t, finalStage, "--no-install-recommends zlib1g-dev ")
+	assert.Contains(t, env.engine.Calls, "RunContainer "+imageRef)
+	assert.Less(t, strings.Index(finalStage, "binutils"), strings.Index(finalStage, "COPY --from=build"))
+	assert.Less(t, strings.Index(finalStage, "COPY --from=build"), strings.Index(finalStage, "zlib1g-dev"))
+}
+
+// TestExecuteCommandsMultiStageSize tests that an image built in multiple stages, which copies only
+// the runtime artifacts of the languages, is reported smaller than the image built in a single stage.
+func TestExecuteCommandsMultiStageSize(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config, "multiStage:\n  enabled: true\n"...), 0644))
+	// The installation of gcc 7 downloads build tools and headers, of which the compiler is a small part.
+	env.engine.LayerSizes["./scripts/gcc_7.sh"] = 180 << 20
+	env.engine.LayerSizes["/usr/lib/gcc/x86_64-linux-gnu/7"] = 40 << 20
+	env.engine.LayerSizes["/usr/bin/gcc-7 "] = 1 << 20
+	env.engine.LayerSizes["/usr/bin/x86_64-linux-gnu-gcc-7"] = 1 << 20
+
+	output := &bytes.Buffer{}
+	asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: output}))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithBuildCommands(asgmtEnv))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	assert.Greater(t, asgmtEnv.ImageSize, int64(40<<20))
+	assert.Less(t, asgmtEnv.ImageSize, asgmtEnv.SingleStageSize)
+	assert.Regexp(t, `Image size [0-9.]+MB in a single stage, [0-9.]+MB in multiple stages \([0-9]+% smaller\)`,
+		output.String())
+}
+
+// TestExecuteCommandsUndoOnBuildFailure tests that a failed build
+// undoes the previously executed commands.
+func TestExecuteCommandsUndoOnBuildFailure(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	env.engine.Failures["BuildImage"] = errors.New("build failed")
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	assert.Error(t, buildManager.ExecuteCommands(context.Background()))
+
+	_, err = os.Stat(env.dockerfileLoc)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 0, asgmtEnv.DockerfileInstructions.Len())
+	assert.NotContains(t, env.engine.RemoteImages, fake.ImageKey(asgmtEnv.ImgBuildConfig.getImageReference()))
+}
+
+// TestExecuteCommandsUndoOnBuildStreamError tests that an error reported
+// by the daemon in the build progress stream undoes the executed commands.
+func TestExecuteCommandsUndoOnBuildStreamError(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	env.engine.StreamErrors["BuildImage"] = "The command '/bin/sh -c ./scripts/gcc_7.sh' returned a non-zero code: 100"
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: ioutil.Discard}))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	err = buildManager.ExecuteCommands(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "returned a non-zero code: 100")
+
+	_, err = os.Stat(env.dockerfileLoc)
+	assert.True(t, os.IsNotExist(err))
+	assert.NotContains(t, env.engine.Calls, "PushImage "+asgmtEnv.ImgBuildConfig.getImageReference())
+}
+
+// TestExecuteCommandsHistory tests that the executions are recorded
+// in the history store along with the undo steps that ran.
+func TestExecuteCommandsHistory(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	historyDir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(historyDir)
+	store, err := history.NewStore(historyDir)
+	assert.NoError(t, err)
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard), WithHistory(store))
+	assert.NoError(t, err)
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+
+	env.engine.Failures["PushImage"] = errors.New("push failed")
+	failedAsgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	failedAsgmtEnv.ImgBuildConfig.languageTag += "-failed"
+	buildManager, err = NewBuildManager(WithCommands(failedAsgmtEnv, ioutil.Discard), WithHistory(store))
+	assert.NoError(t, err)
+	assert.Error(t, buildManager.ExecuteCommands(context.Background()))
+
+	records, err := store.List()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	succeeded := records[0]
+	digest, err := asgmtEnv.AsgmtEnvConfig.GetDigest()
+	assert.NoError(t, err)
+	assert.Equal(t, history.Succeeded, succeeded.Outcome)
+	assert.Equal(t, digest, succeeded.ConfigDigest)
+	assert.Equal(t, asgmtEnv.GetImageReference(), succeeded.Image)
+	assert.Equal(t, asgmtEnv.ImageDigest, succeeded.ImageDigest)
+	assert.Equal(t, asgmtEnv.DockerfileInstructions.String(), succeeded.Dockerfile)
+	var phases []string
+	for _, phase := range succeeded.Phases {
+		phases = append(phases, phase.Name)
+	}
+	assert.Equal(t, []string{"verify", "write", "build", "smoke", "compatibility", "publish"}, phases)
+	assert.Empty(t, succeeded.UndoSteps)
+
+	failed := records[1]
+	assert.Equal(t, history.Failed, failed.Outcome)
+	assert.Contains(t, failed.Error, "push failed")
+	assert.Contains(t, failed.Phases[5].Error, "push failed")
+	assert.NotEmpty(t, failed.Dockerfile)
+	assert.Equal(t, []history.UndoStep{{Phase: "publish"}, {Phase: "compatibility"}, {Phase: "smoke"}, {Phase: "build"}, {Phase: "write"}, {Phase: "verify"}},
+		failed.UndoSteps)
+}
+
+// TestExecuteCommandsSmokeTestFailure tests that a failing smoke check blocks
+// the publish and removes the built image.
+func TestExecuteCommandsSmokeTestFailure(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	env.engine.ContainerResults["hello.c"] = containers.ContainerResult{ExitCode: 127, Output: "gcc-7: not found\n"}
+	output := &bytes.Buffer{}
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: output}))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+
+	err = buildManager.ExecuteCommands(context.Background())
+	assert.EqualError(t, err, "smoke check compile and run hello.c failed with exit code 127")
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	assert.Contains(t, env.engine.Calls, "RunContainer "+imageRef)
+	assert.Contains(t, env.engine.Calls, "RemoveImage "+imageRef)
+	assert.NotContains(t, env.engine.Calls, "PushImage "+imageRef)
+	assert.Empty(t, env.engine.LocalImages)
+	assert.Contains(t, output.String(), "[smoke] gcc-7: not found")
+}
+
+// TestExecuteCommandsCodeRunnerCheckFailure tests that an image whose code-runner
+// is not healthy, as started with the configured port and arguments, is not published.
+func TestExecuteCommandsCodeRunnerCheckFailure(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	env.engine.CodeRunnerHandler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/status" {
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	})
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(env.configFile,
+		append(config, []byte("codeRunner:\n  port: 8080\n  args: [\"-port\", \"8080\", \"-verbose\"]\n")...), 0644))
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+
+	err = buildManager.ExecuteCommands(context.Background())
+	assert.EqualError(t, err, "code-runner health check /health failed: unexpected status 404 Not Found")
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	assert.Contains(t, env.engine.Calls, "StartContainer "+imageRef+" -port 8080 -verbose")
+	assert.NotContains(t, env.engine.Calls, "PushImage "+imageRef)
+	assert.Empty(t, env.engine.LocalImages)
+	assert.Equal(t, "docker run --publish 8080:8080 "+imageRef+" -port 8080 -verbose",
+		asgmtEnv.AsgmtEnvConfig.CodeRunner.GetRunCommand(imageRef))
+}
+
+// TestExecuteCommandsCancelled tests that cancelling the context stops the
+// execution and undoes the previously executed commands.
+func TestExecuteCommandsCancelled(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = buildManager.ExecuteCommands(ctx)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.NotContains(t, env.engine.Calls, "BuildImage "+asgmtEnv.ImgBuildConfig.getImageReference())
+}
+
+// TestExecuteCommandsPhaseTimeout tests that a phase exceeding its timeout fails
+// with a timeout error, and that the image built before the timeout is removed.
+func TestExecuteCommandsPhaseTimeout(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: ioutil.Discard}),
+		WithPhaseTimeouts(configurations.PhaseTimeouts{Publish: time.Nanosecond}))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+
+	err = buildManager.ExecuteCommands(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "publish phase timed out after 1ns")
+	imageKey := fake.ImageKey(asgmtEnv.ImgBuildConfig.getImageReference())
+	assert.NotContains(t, env.engine.LocalImages, imageKey)
+	assert.NotContains(t, env.engine.RemoteImages, imageKey)
+
+	_, err = GetConfigurations(true, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithPhaseTimeouts(configurations.PhaseTimeouts{Build: -time.Second}))
+	assert.Error(t, err)
+}
+
+// TestSelectiveCommands tests the commands of the render, build, inspect and
+// clean subcommands against the in-memory container engine.
+func TestSelectiveCommands(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	execute := func(option BuildManagerOption) {
+		buildManager, err := NewBuildManager(option)
+		assert.NoError(t, err)
+		assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+	}
+	newAsgmtEnv := func() *assignmentEnvironmentImageBuilder {
+		asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc,
+			WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: ioutil.Discard}))
+		assert.NoError(t, err)
+		return asgmtEnv
+	}
+
+	output := &bytes.Buffer{}
+	execute(WithRenderCommands(newAsgmtEnv(), output))
+	assert.True(t, strings.HasPrefix(output.String(), "FROM "+env.registry+"/assignmentexec/code-runner@sha256:code-runner\n"))
+	_, err := os.Stat(env.dockerfileLoc)
+	assert.True(t, os.IsNotExist(err))
+
+	asgmtEnv := newAsgmtEnv()
+	execute(WithBuildCommands(asgmtEnv))
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	assert.Contains(t, env.engine.LocalImages, fake.ImageKey(imageRef))
+	assert.NotContains(t, env.engine.RemoteImages, fake.ImageKey(imageRef))
+
+	output.Reset()
+	execute(WithInspectCommands(newAsgmtEnv(), output))
+	assert.Regexp(t, `Image:\s+`+regexp.QuoteMeta(imageRef)+"\n", output.String())
+	assert.Regexp(t, `Registry digest:\s+not published\n`, output.String())
+	assert.Regexp(t, `org.assignment-exec.language\s+gcc 7\n`, output.String())
+
+	output.Reset()
+	execute(WithCleanCommands(env.engine, output))
+	assert.Equal(t, "Removed "+fake.ImageKey(imageRef)+"\n", output.String())
+	assert.Empty(t, env.engine.LocalImages)
+}
@@ -0,0 +1,72 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/constants"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// cleanCommand struct type holds the container engine whose local images
+// created by the image builder are to be removed, and the writer to report
+// the removed images to.
+type cleanCommand struct {
+	engine containers.ContainerEngine
+	writer io.Writer
+}
+
+// execute removes all local images that carry the configuration digest label,
+// i.e all images that were built by the image builder.
+func (cmd *cleanCommand) execute(ctx context.Context) error {
+	images, err := cmd.engine.ListImages(ctx, constants.LabelConfigDigest)
+	if err != nil {
+		return errors.Wrap(err, "error in listing images")
+	}
+
+	for _, image := range images {
+		for _, ref := range getImageRefs(image) {
+			if err := cmd.engine.RemoveImage(ctx, ref); err != nil {
+				return errors.Wrapf(err, "error in removing image %s", ref)
+			}
+			fmt.Fprintf(cmd.writer, "Removed %s\n", ref)
+		}
+	}
+	return nil
+}
+
+// undo is a No operation function as removed images cannot be restored.
+func (cmd *cleanCommand) undo() error {
+	// No operation.
+	return nil
+}
+
+// plan reports the local images that would be removed.
+func (cmd *cleanCommand) plan(ctx context.Context, plan *Plan) error {
+	images, err := cmd.engine.ListImages(ctx, constants.LabelConfigDigest)
+	if err != nil {
+		return errors.Wrap(err, "error in listing images")
+	}
+	for _, image := range images {
+		for _, ref := range getImageRefs(image) {
+			plan.addAction("clean", "remove image %s", ref)
+		}
+	}
+	return nil
+}
+
+// getImageRefs returns the tags of the image, or its ID if it is untagged.
+func getImageRefs(image containers.ImageInfo) []string {
+	if len(image.RepoTags) == 0 {
+		return []string{image.ID}
+	}
+	return image.RepoTags
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *cleanCommand) phase() string {
+	return "clean"
+}
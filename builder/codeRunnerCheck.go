@@ -0,0 +1,149 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/constants"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// portPollInterval is the interval between the attempts to connect to the code-runner port.
+const portPollInterval = 200 * time.Millisecond
+
+// codeRunnerCheckPassed is the value of the code-runner check label of an image that passed the check.
+const codeRunnerCheckPassed = "passed"
+
+// checkCodeRunner starts the code-runner of the image as configured, waits for its port to
+// accept connections and checks that its health endpoint responds successfully.
+// The image built by this run is then labelled with the result of the check.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) checkCodeRunner(ctx context.Context) error {
+	codeRunner := asgmtEnv.AsgmtEnvConfig.CodeRunner
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+
+	running, err := asgmtEnv.engine.StartContainer(ctx, imageRef, codeRunner.GetArgs(), codeRunner.GetPort())
+	if running != nil && running.ID != "" {
+		defer func() {
+			// The container is removed even if the execution has been cancelled.
+			if err := asgmtEnv.engine.StopContainer(context.Background(), running.ID); err != nil {
+				log.Printf("error in removing code-runner container %s: %v", running.ID, err)
+			}
+		}()
+	}
+	if err != nil {
+		return errors.Wrap(err, "error in starting code-runner")
+	}
+	if err := asgmtEnv.renderCompatibilityStatus("Started code-runner on %s", running.Address); err != nil {
+		return err
+	}
+
+	if err := waitForPort(ctx, running.Address, codeRunner.GetStartTimeout()); err != nil {
+		return errors.Wrapf(err, "code-runner port %d not accepting connections", codeRunner.GetPort())
+	}
+	healthURL := "http://" + running.Address + codeRunner.GetHealthPath()
+	if err := checkHealth(ctx, healthURL); err != nil {
+		return errors.Wrapf(err, "code-runner health check %s failed", codeRunner.GetHealthPath())
+	}
+	if err := asgmtEnv.renderCompatibilityStatus("Code-runner health check %s passed", codeRunner.GetHealthPath()); err != nil {
+		return err
+	}
+
+	// The existing image has been checked when it was built.
+	if asgmtEnv.ImageExists {
+		return nil
+	}
+	return asgmtEnv.labelImage(ctx, map[string]string{
+		constants.LabelCodeRunnerCheck: codeRunnerCheckPassed,
+		constants.LabelCodeRunnerPort:  fmt.Sprint(codeRunner.GetPort()),
+	})
+}
+
+// renderCompatibilityStatus renders the formatted message as a status event of the compatibility phase.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) renderCompatibilityStatus(format string, args ...interface{}) error {
+	return asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "compatibility", Message: fmt.Sprintf(format, args...)})
+}
+
+// waitForPort connects to the address repeatedly until a connection is accepted,
+// the timeout elapses or the context is done.
+func waitForPort(ctx context.Context, address string, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	for {
+		conn, err := dialer.DialContext(waitCtx, "tcp", address)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Errorf("timed out after %s: %v", timeout, err)
+		case <-time.After(portPollInterval):
+		}
+	}
+}
+
+// checkHealth requests the health endpoint and checks that it responds with a success status.
+func checkHealth(ctx context.Context, url string) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// labelImage adds the labels to the built image by building an image from it under the
+// same reference, which carries the labels of the built image along with the given labels.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) labelImage(ctx context.Context, labels map[string]string) error {
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	imageLabels := make(map[string]string)
+	for key, value := range asgmtEnv.ImgBuildConfig.imageLabels {
+		imageLabels[key] = value
+	}
+	for key, value := range labels {
+		imageLabels[key] = value
+	}
+
+	buildCtx := newBuildContext()
+	if err := buildCtx.add("Dockerfile", []byte(NewDockerfile(&FromInstruction{Image: imageRef}).String()), 0644); err != nil {
+		return errors.Wrap(err, "error in labelling image")
+	}
+	buildContext, err := buildCtx.getTar()
+	if err != nil {
+		return errors.Wrap(err, "error in labelling image")
+	}
+	response, err := asgmtEnv.engine.BuildImage(ctx, buildContext, containers.ImageBuildOptions{
+		Dockerfile: "Dockerfile",
+		Tags:       []string{imageRef},
+		Labels:     imageLabels})
+	if err != nil {
+		return errors.Wrap(err, "error in labelling image")
+	}
+	defer response.Close()
+
+	result, err := decodeProgress("compatibility", response, asgmtEnv.renderer)
+	if err != nil {
+		return errors.Wrap(err, "error in labelling image")
+	}
+	asgmtEnv.ImgBuildConfig.imageLabels = imageLabels
+	if result.ImageID != "" {
+		asgmtEnv.ImageID = result.ImageID
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"context"
+	"strings"
+)
+
+// codeRunnerCheckCommand struct type holds assignmentEnvironmentImageBuilder instance
+// which is required to check the compatibility of the code-runner of the built image.
+type codeRunnerCheckCommand struct {
+	asgmtEnv *assignmentEnvironmentImageBuilder
+}
+
+// execute invokes the checkCodeRunner function to start the code-runner of the image
+// and check its port and health endpoint.
+func (cmd *codeRunnerCheckCommand) execute(ctx context.Context) error {
+	return cmd.asgmtEnv.runPhase(ctx, "compatibility", cmd.asgmtEnv.checkCodeRunner)
+}
+
+// undo is a No operation function as the code-runner container is removed once
+// checked, whereas the image is removed by the undo of the build.
+func (cmd *codeRunnerCheckCommand) undo() error {
+	// No operation.
+	return nil
+}
+
+// plan reports how the code-runner of the image would be started and checked.
+func (cmd *codeRunnerCheckCommand) plan(ctx context.Context, plan *Plan) error {
+	codeRunner := cmd.asgmtEnv.AsgmtEnvConfig.CodeRunner
+	plan.addAction("compatibility", "start code-runner of %s with arguments %q and check port %d and health endpoint %s",
+		cmd.asgmtEnv.ImgBuildConfig.getImageReference(), strings.Join(codeRunner.GetArgs(), " "),
+		codeRunner.GetPort(), codeRunner.GetHealthPath())
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *codeRunnerCheckCommand) phase() string {
+	return "compatibility"
+}
@@ -2,12 +2,20 @@
 // build its docker image and publish it to docker hub.
 package builder
 
+import "context"
+
 // command interface type represents the execute
 // and undo function required by different commands
-// to perform respective operations.
+// to perform respective operations, and the plan function
+// that reports the intended effect of execute without performing it.
+// The execution and planning stop once the given context is done, whereas
+// the undo is run to completion even if the execution has been cancelled.
+// The phase function returns the name of the phase that the command performs.
 type command interface {
-	execute() error
+	execute(ctx context.Context) error
 	undo() error
+	plan(ctx context.Context, plan *Plan) error
+	phase() string
 }
 
 // stack type for holding the commands in the order of their execution.
@@ -0,0 +1,64 @@
+// Package containers declares the container engine that the builder verifies, builds,
+// publishes and removes the images with, along with the images and containers it handles.
+package containers
+
+import (
+	"context"
+	"io"
+)
+
+// ContainerEngine interface type represents the operations of a container engine
+// that are required to verify, build, publish and remove the assignment environment image.
+//
+// Build, push and pull return the progress stream of the operation as a stream of
+// JSON messages (as produced by the docker daemon), which must be closed by the caller.
+// Registry authentication is passed as the encoded value of the registry auth header.
+// Images are listed by the key of a label that they carry.
+// A container is run from an image to completion and removed once it exits, or else
+// started in the background with a port published on the loopback address of the host,
+// and stopped and removed by its ID.
+type ContainerEngine interface {
+	BuildImage(ctx context.Context, buildContext io.Reader, options ImageBuildOptions) (io.ReadCloser, error)
+	PushImage(ctx context.Context, ref string, registryAuth string) (io.ReadCloser, error)
+	PullImage(ctx context.Context, ref string, registryAuth string) (io.ReadCloser, error)
+	RemoveImage(ctx context.Context, ref string) error
+	InspectImage(ctx context.Context, ref string) (*ImageInfo, error)
+	ListImages(ctx context.Context, label string) ([]ImageInfo, error)
+	RunContainer(ctx context.Context, ref string, cmd []string) (*ContainerResult, error)
+	StartContainer(ctx context.Context, ref string, args []string, port int) (*RunningContainer, error)
+	StopContainer(ctx context.Context, id string) error
+}
+
+// ImageBuildOptions struct type holds the options to build an image,
+// i.e the dockerfile name within the build context, the tags and labels
+// of the resulting image and the values of the build arguments.
+type ImageBuildOptions struct {
+	Dockerfile string
+	Tags       []string
+	Labels     map[string]string
+	BuildArgs  map[string]string
+}
+
+// ImageInfo struct type holds the details of an image that is
+// present on the container engine.
+type ImageInfo struct {
+	ID          string
+	RepoTags    []string
+	RepoDigests []string
+	Labels      map[string]string
+	Size        int64
+}
+
+// ContainerResult struct type holds the exit code and the combined
+// standard output and error of a container that has been run to completion.
+type ContainerResult struct {
+	ExitCode int
+	Output   string
+}
+
+// RunningContainer struct type holds the ID of a container started in the background
+// and the host address, i.e `host:port`, that its published port is reachable on.
+type RunningContainer struct {
+	ID      string
+	Address string
+}
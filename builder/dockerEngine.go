@@ -0,0 +1,182 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"net"
+)
+
+// dockerEngine is the containers.ContainerEngine implementation backed by the docker
+// client (here - https://github.com/moby/moby/tree/master/client).
+type dockerEngine struct {
+	client *client.Client
+}
+
+// NewDockerEngine creates a containers.ContainerEngine that talks to the docker daemon
+// configured through the docker environment variables.
+func NewDockerEngine() (containers.ContainerEngine, error) {
+	dockerClient, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error in creating a docker client")
+	}
+	return &dockerEngine{client: dockerClient}, nil
+}
+
+// BuildImage builds an image from the given build context.
+func (engine *dockerEngine) BuildImage(ctx context.Context, buildContext io.Reader, options containers.ImageBuildOptions) (io.ReadCloser, error) {
+	// The docker client distinguishes the build arguments without a value, which are read from the environment.
+	buildArgs := make(map[string]*string)
+	for name, value := range options.BuildArgs {
+		value := value
+		buildArgs[name] = &value
+	}
+	response, err := engine.client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Dockerfile: options.Dockerfile,
+		Tags:       options.Tags,
+		Labels:     options.Labels,
+		BuildArgs:  buildArgs})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// PushImage pushes the image with the given reference to its registry.
+func (engine *dockerEngine) PushImage(ctx context.Context, ref string, registryAuth string) (io.ReadCloser, error) {
+	return engine.client.ImagePush(ctx, ref, types.ImagePushOptions{RegistryAuth: registryAuth})
+}
+
+// PullImage pulls the image with the given reference from its registry.
+func (engine *dockerEngine) PullImage(ctx context.Context, ref string, registryAuth string) (io.ReadCloser, error) {
+	return engine.client.ImagePull(ctx, ref, types.ImagePullOptions{RegistryAuth: registryAuth})
+}
+
+// RemoveImage forcefully removes the local image with the given reference.
+func (engine *dockerEngine) RemoveImage(ctx context.Context, ref string) error {
+	_, err := engine.client.ImageRemove(ctx, ref, types.ImageRemoveOptions{Force: true})
+	return err
+}
+
+// InspectImage returns the details of the local image with the given reference.
+func (engine *dockerEngine) InspectImage(ctx context.Context, ref string) (*containers.ImageInfo, error) {
+	inspect, _, err := engine.client.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	info := &containers.ImageInfo{
+		ID:          inspect.ID,
+		RepoTags:    inspect.RepoTags,
+		RepoDigests: inspect.RepoDigests,
+		Size:        inspect.Size,
+	}
+	if inspect.Config != nil {
+		info.Labels = inspect.Config.Labels
+	}
+	return info, nil
+}
+
+// ListImages returns the details of the local images that carry the given label.
+func (engine *dockerEngine) ListImages(ctx context.Context, label string) ([]containers.ImageInfo, error) {
+	labelFilter := filters.NewArgs()
+	labelFilter.Add("label", label)
+	summaries, err := engine.client.ImageList(ctx, types.ImageListOptions{Filters: labelFilter})
+	if err != nil {
+		return nil, err
+	}
+	var images []containers.ImageInfo
+	for _, summary := range summaries {
+		images = append(images, containers.ImageInfo{
+			ID:          summary.ID,
+			RepoTags:    summary.RepoTags,
+			RepoDigests: summary.RepoDigests,
+			Labels:      summary.Labels,
+			Size:        summary.Size,
+		})
+	}
+	return images, nil
+}
+
+// RunContainer creates a container from the image with the given reference, which runs
+// the command in place of the entrypoint of the image, waits for it to exit and collects
+// its logs. The container is forcefully removed afterwards.
+func (engine *dockerEngine) RunContainer(ctx context.Context, ref string, cmd []string) (*containers.ContainerResult, error) {
+	created, err := engine.client.ContainerCreate(ctx, &container.Config{Image: ref, Entrypoint: cmd}, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// The container is removed even if the execution has been cancelled.
+		err := engine.client.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			log.Printf("error in removing container %s: %v", created.ID, err)
+		}
+	}()
+
+	if err := engine.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+	exitCode, err := engine.client.ContainerWait(ctx, created.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := engine.client.ContainerLogs(ctx, created.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+	output := &bytes.Buffer{}
+	if _, err := stdcopy.StdCopy(output, output, logs); err != nil {
+		return nil, errors.Wrap(err, "error in reading container logs")
+	}
+	return &containers.ContainerResult{ExitCode: int(exitCode), Output: output.String()}, nil
+}
+
+// StartContainer creates and starts a container from the image with the given reference,
+// which runs the entrypoint of the image with the given arguments. The port of the container
+// is published on a random port of the loopback address of the host.
+func (engine *dockerEngine) StartContainer(ctx context.Context, ref string, args []string, port int) (*containers.RunningContainer, error) {
+	containerPort, err := nat.NewPort("tcp", fmt.Sprint(port))
+	if err != nil {
+		return nil, err
+	}
+	created, err := engine.client.ContainerCreate(ctx,
+		&container.Config{Image: ref, Cmd: args, ExposedPorts: nat.PortSet{containerPort: struct{}{}}},
+		&container.HostConfig{PortBindings: nat.PortMap{containerPort: {{HostIP: "127.0.0.1"}}}}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	running := &containers.RunningContainer{ID: created.ID}
+
+	if err := engine.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return running, err
+	}
+	inspect, err := engine.client.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		return running, err
+	}
+	if inspect.NetworkSettings == nil || len(inspect.NetworkSettings.Ports[containerPort]) == 0 {
+		return running, errors.Errorf("port %d of container %s is not published", port, created.ID)
+	}
+	binding := inspect.NetworkSettings.Ports[containerPort][0]
+	running.Address = net.JoinHostPort(binding.HostIP, binding.HostPort)
+	return running, nil
+}
+
+// StopContainer forcefully removes the container with the given ID, stopping it if it is running.
+func (engine *dockerEngine) StopContainer(ctx context.Context, id string) error {
+	return engine.client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+}
@@ -0,0 +1,644 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// plainWordPattern matches the words that are rendered without quotes.
+var plainWordPattern = regexp.MustCompile(`^[A-Za-z0-9_./:@+=,%~-]+$`)
+
+// Instruction interface type is implemented by every typed dockerfile instruction,
+// which renders its arguments in the canonical format.
+type Instruction interface {
+	Keyword() string
+	arguments() string
+	validate() error
+}
+
+// KeyValue struct type holds a key and its value, e.g of an environment variable or a label.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// FromInstruction struct type holds the image that a build stage starts from,
+// along with the name of the stage, if any.
+type FromInstruction struct {
+	Image string
+	Stage string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *FromInstruction) Keyword() string {
+	return "FROM"
+}
+
+// arguments renders the image, followed by the name of the stage, if any.
+func (instruction *FromInstruction) arguments() string {
+	if instruction.Stage == "" {
+		return instruction.Image
+	}
+	return instruction.Image + " AS " + instruction.Stage
+}
+
+// validate checks that the image and the name of the stage are single plain words.
+func (instruction *FromInstruction) validate() error {
+	if !plainWordPattern.MatchString(instruction.Image) {
+		return errors.Errorf("invalid image %q", instruction.Image)
+	}
+	if instruction.Stage != "" && !plainWordPattern.MatchString(instruction.Stage) {
+		return errors.Errorf("invalid stage name %q", instruction.Stage)
+	}
+	return nil
+}
+
+// CopyInstruction struct type holds the sources copied into the image, their destination,
+// the owner of the copied files and the stage they are copied from, if any.
+type CopyInstruction struct {
+	Sources     []string
+	Destination string
+	Chown       string
+	From        string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *CopyInstruction) Keyword() string {
+	return "COPY"
+}
+
+// arguments renders the flags followed by the paths, which are rendered
+// as a JSON array if any of them would otherwise require quoting.
+func (instruction *CopyInstruction) arguments() string {
+	var flags []string
+	if instruction.From != "" {
+		flags = append(flags, "--from="+instruction.From)
+	}
+	if instruction.Chown != "" {
+		flags = append(flags, "--chown="+instruction.Chown)
+	}
+
+	paths := append(append([]string{}, instruction.Sources...), instruction.Destination)
+	plain := true
+	for _, path := range paths {
+		plain = plain && plainWordPattern.MatchString(path)
+	}
+	if plain {
+		return strings.Join(append(flags, paths...), " ")
+	}
+	encoded, _ := json.Marshal(paths)
+	return strings.Join(append(flags, strings.Replace(string(encoded), `","`, `", "`, -1)), " ")
+}
+
+// validate checks that there is at least one source and a destination, none of which span lines.
+func (instruction *CopyInstruction) validate() error {
+	if len(instruction.Sources) == 0 || instruction.Destination == "" {
+		return errors.New("copy requires at least one source and a destination")
+	}
+	for _, value := range append([]string{instruction.Destination, instruction.From, instruction.Chown},
+		instruction.Sources...) {
+		if strings.ContainsAny(value, "\n\r") {
+			return errors.Errorf("invalid path %q", value)
+		}
+	}
+	for _, flag := range []string{instruction.From, instruction.Chown} {
+		if flag != "" && !plainWordPattern.MatchString(flag) {
+			return errors.Errorf("invalid copy flag %q", flag)
+		}
+	}
+	return nil
+}
+
+// RunInstruction struct type holds the shell command run while building the image.
+type RunInstruction struct {
+	Command string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *RunInstruction) Keyword() string {
+	return "RUN"
+}
+
+// arguments renders the command in the shell form.
+func (instruction *RunInstruction) arguments() string {
+	return instruction.Command
+}
+
+// validate checks that the command is given on a single line.
+func (instruction *RunInstruction) validate() error {
+	return validateCommand(instruction.Command)
+}
+
+// EnvInstruction struct type holds the environment variables set in the image.
+type EnvInstruction struct {
+	Variables []KeyValue
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *EnvInstruction) Keyword() string {
+	return "ENV"
+}
+
+// arguments renders the variables as `key=value` pairs.
+func (instruction *EnvInstruction) arguments() string {
+	return renderKeyValues(instruction.Variables)
+}
+
+// validate checks the names and values of the variables.
+func (instruction *EnvInstruction) validate() error {
+	return validateKeyValues("environment variable", instruction.Variables)
+}
+
+// ArgInstruction struct type holds a build argument declared by the dockerfile, along with its
+// default value, if any. The value of the argument is given to the container engine by the build.
+type ArgInstruction struct {
+	Name    string
+	Default string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *ArgInstruction) Keyword() string {
+	return "ARG"
+}
+
+// arguments renders the name of the argument, followed by its default value if any.
+func (instruction *ArgInstruction) arguments() string {
+	if instruction.Default == "" {
+		return quoteWord(instruction.Name)
+	}
+	return renderKeyValues([]KeyValue{{Key: instruction.Name, Value: instruction.Default}})
+}
+
+// validate checks the name and the default value of the argument.
+func (instruction *ArgInstruction) validate() error {
+	return validateKeyValues("build argument", []KeyValue{{Key: instruction.Name, Value: instruction.Default}})
+}
+
+// LabelInstruction struct type holds the labels of the image.
+type LabelInstruction struct {
+	Labels []KeyValue
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *LabelInstruction) Keyword() string {
+	return "LABEL"
+}
+
+// arguments renders the labels as `key=value` pairs.
+func (instruction *LabelInstruction) arguments() string {
+	return renderKeyValues(instruction.Labels)
+}
+
+// validate checks the keys and values of the labels.
+func (instruction *LabelInstruction) validate() error {
+	return validateKeyValues("label", instruction.Labels)
+}
+
+// UserInstruction struct type holds the user, and optionally the group, that runs
+// the following instructions and the container.
+type UserInstruction struct {
+	User string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *UserInstruction) Keyword() string {
+	return "USER"
+}
+
+// arguments renders the user.
+func (instruction *UserInstruction) arguments() string {
+	return instruction.User
+}
+
+// validate checks that the user is a single plain word.
+func (instruction *UserInstruction) validate() error {
+	if !plainWordPattern.MatchString(instruction.User) {
+		return errors.Errorf("invalid user %q", instruction.User)
+	}
+	return nil
+}
+
+// WorkdirInstruction struct type holds the working directory of the following
+// instructions and of the container.
+type WorkdirInstruction struct {
+	Path string
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *WorkdirInstruction) Keyword() string {
+	return "WORKDIR"
+}
+
+// arguments renders the path, quoted if required.
+func (instruction *WorkdirInstruction) arguments() string {
+	return quoteWord(instruction.Path)
+}
+
+// validate checks that the path is given on a single line.
+func (instruction *WorkdirInstruction) validate() error {
+	if instruction.Path == "" || strings.ContainsAny(instruction.Path, "\n\r") {
+		return errors.Errorf("invalid working directory %q", instruction.Path)
+	}
+	return nil
+}
+
+// HealthcheckInstruction struct type holds the shell command checking the health of the
+// container along with the options of the check. An empty command disables any health
+// check inherited from the base image.
+type HealthcheckInstruction struct {
+	Command     string
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
+}
+
+// Keyword returns the keyword of the instruction.
+func (instruction *HealthcheckInstruction) Keyword() string {
+	return "HEALTHCHECK"
+}
+
+// arguments renders the options followed by the command in the shell form, or NONE.
+func (instruction *HealthcheckInstruction) arguments() string {
+	if instruction.Command == "" {
+		return "NONE"
+	}
+	var options []string
+	for _, option := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"interval", instruction.Interval},
+		{"timeout", instruction.Timeout},
+		{"start-period", instruction.StartPeriod},
+	} {
+		if option.duration != 0 {
+			options = append(options, fmt.Sprintf("--%s=%s", option.name, option.duration))
+		}
+	}
+	if instruction.Retries != 0 {
+		options = append(options, fmt.Sprintf("--retries=%d", instruction.Retries))
+	}
+	return strings.Join(append(options, "CMD", instruction.Command), " ")
+}
+
+// validate checks that the command is given on a single line and that the options are positive.
+func (instruction *HealthcheckInstruction) validate() error {
+	if instruction.Interval < 0 || instruction.Timeout < 0 || instruction.StartPeriod < 0 || instruction.Retries < 0 {
+		return errors.New("health check options cannot be negative")
+	}
+	if instruction.Command == "" {
+		if instruction.Interval != 0 || instruction.Timeout != 0 || instruction.StartPeriod != 0 || instruction.Retries != 0 {
+			return errors.New("health check options given without a command")
+		}
+		return nil
+	}
+	return validateCommand(instruction.Command)
+}
+
+// Dockerfile struct type holds the instructions of a dockerfile,
+// which is rendered in a single canonical format.
+type Dockerfile struct {
+	Instructions []Instruction
+}
+
+// NewDockerfile creates a dockerfile holding the given instructions.
+func NewDockerfile(instructions ...Instruction) *Dockerfile {
+	return &Dockerfile{Instructions: instructions}
+}
+
+// Add appends the given instructions to the dockerfile.
+func (dockerfile *Dockerfile) Add(instructions ...Instruction) {
+	dockerfile.Instructions = append(dockerfile.Instructions, instructions...)
+}
+
+// Len returns the number of instructions of the dockerfile.
+func (dockerfile *Dockerfile) Len() int {
+	return len(dockerfile.Instructions)
+}
+
+// Reset removes all the instructions of the dockerfile.
+func (dockerfile *Dockerfile) Reset() {
+	dockerfile.Instructions = nil
+}
+
+// Validate checks that every instruction can be rendered, and that the dockerfile starts from an image.
+func (dockerfile *Dockerfile) Validate() error {
+	for i, instruction := range dockerfile.Instructions {
+		if i == 0 && instruction.Keyword() != "FROM" {
+			return errors.New("dockerfile does not start with a FROM instruction")
+		}
+		if err := instruction.validate(); err != nil {
+			return errors.Wrapf(err, "invalid %s instruction %d", instruction.Keyword(), i+1)
+		}
+	}
+	return nil
+}
+
+// String renders the dockerfile in the canonical format, i.e one instruction per line,
+// each of which is terminated by a newline.
+func (dockerfile *Dockerfile) String() string {
+	builder := &strings.Builder{}
+	for _, instruction := range dockerfile.Instructions {
+		builder.WriteString(instruction.Keyword())
+		builder.WriteString(" ")
+		builder.WriteString(instruction.arguments())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// ParseDockerfile parses the text of a dockerfile into its instructions. Comments and empty
+// lines are skipped, and lines continued by a trailing backslash are joined together.
+// It returns error for any instruction that is not supported by the model.
+func ParseDockerfile(text string) (*Dockerfile, error) {
+	dockerfile := &Dockerfile{}
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(lines[i])
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		keyword, arguments := strings.ToUpper(parts[0]), ""
+		if len(parts) == 2 {
+			arguments = strings.TrimSpace(parts[1])
+		}
+		instruction, err := parseInstruction(keyword, arguments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in line %d", lineNumber)
+		}
+		dockerfile.Add(instruction)
+	}
+	return dockerfile, nil
+}
+
+// parseInstruction parses the arguments of the instruction with the given keyword.
+func parseInstruction(keyword string, arguments string) (Instruction, error) {
+	switch keyword {
+	case "RUN":
+		return &RunInstruction{Command: arguments}, nil
+	case "HEALTHCHECK":
+		return parseHealthcheck(arguments)
+	case "COPY":
+		return parseCopy(arguments)
+	}
+
+	words, err := splitWords(arguments)
+	if err != nil {
+		return nil, err
+	}
+	switch keyword {
+	case "FROM":
+		if len(words) == 1 {
+			return &FromInstruction{Image: words[0]}, nil
+		}
+		if len(words) == 3 && strings.ToUpper(words[1]) == "AS" {
+			return &FromInstruction{Image: words[0], Stage: words[2]}, nil
+		}
+		return nil, errors.Errorf("invalid FROM arguments %q", arguments)
+	case "ENV", "LABEL":
+		keyValues, err := parseKeyValues(words)
+		if err != nil {
+			return nil, err
+		}
+		if keyword == "ENV" {
+			return &EnvInstruction{Variables: keyValues}, nil
+		}
+		return &LabelInstruction{Labels: keyValues}, nil
+	case "ARG":
+		if len(words) != 1 {
+			return nil, errors.New("ARG requires a single argument")
+		}
+		parts := strings.SplitN(words[0], "=", 2)
+		if len(parts) == 2 {
+			return &ArgInstruction{Name: parts[0], Default: parts[1]}, nil
+		}
+		return &ArgInstruction{Name: parts[0]}, nil
+	case "USER", "WORKDIR":
+		if len(words) != 1 {
+			return nil, errors.Errorf("%s requires a single argument", keyword)
+		}
+		if keyword == "USER" {
+			return &UserInstruction{User: words[0]}, nil
+		}
+		return &WorkdirInstruction{Path: words[0]}, nil
+	}
+	return nil, errors.Errorf("unsupported instruction %s", keyword)
+}
+
+// parseCopy parses the flags and the paths of a COPY instruction,
+// which are given either as words or as a JSON array.
+func parseCopy(arguments string) (Instruction, error) {
+	instruction := &CopyInstruction{}
+	for strings.HasPrefix(arguments, "--") {
+		parts := strings.SplitN(arguments, " ", 2)
+		flag := strings.SplitN(parts[0], "=", 2)
+		if len(flag) != 2 {
+			return nil, errors.Errorf("invalid COPY flag %s", parts[0])
+		}
+		switch flag[0] {
+		case "--from":
+			instruction.From = flag[1]
+		case "--chown":
+			instruction.Chown = flag[1]
+		default:
+			return nil, errors.Errorf("unsupported COPY flag %s", flag[0])
+		}
+		arguments = ""
+		if len(parts) == 2 {
+			arguments = strings.TrimSpace(parts[1])
+		}
+	}
+
+	var paths []string
+	if strings.HasPrefix(arguments, "[") {
+		if err := json.Unmarshal([]byte(arguments), &paths); err != nil {
+			return nil, errors.Wrap(err, "invalid COPY paths")
+		}
+	} else {
+		words, err := splitWords(arguments)
+		if err != nil {
+			return nil, err
+		}
+		paths = words
+	}
+	if len(paths) < 2 {
+		return nil, errors.New("COPY requires at least one source and a destination")
+	}
+	instruction.Sources, instruction.Destination = paths[:len(paths)-1], paths[len(paths)-1]
+	return instruction, nil
+}
+
+// parseHealthcheck parses the options and the command of a HEALTHCHECK instruction.
+func parseHealthcheck(arguments string) (Instruction, error) {
+	instruction := &HealthcheckInstruction{}
+	if strings.ToUpper(arguments) == "NONE" {
+		return instruction, nil
+	}
+	for strings.HasPrefix(arguments, "--") {
+		parts := strings.SplitN(arguments, " ", 2)
+		option := strings.SplitN(parts[0], "=", 2)
+		if len(option) != 2 || len(parts) != 2 {
+			return nil, errors.Errorf("invalid HEALTHCHECK option %s", parts[0])
+		}
+		var err error
+		switch option[0] {
+		case "--interval":
+			instruction.Interval, err = time.ParseDuration(option[1])
+		case "--timeout":
+			instruction.Timeout, err = time.ParseDuration(option[1])
+		case "--start-period":
+			instruction.StartPeriod, err = time.ParseDuration(option[1])
+		case "--retries":
+			instruction.Retries, err = strconv.Atoi(option[1])
+		default:
+			return nil, errors.Errorf("unsupported HEALTHCHECK option %s", option[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid HEALTHCHECK option %s", option[0])
+		}
+		arguments = strings.TrimSpace(parts[1])
+	}
+
+	parts := strings.SplitN(arguments, " ", 2)
+	if strings.ToUpper(parts[0]) != "CMD" || len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, errors.New("HEALTHCHECK requires NONE or a CMD")
+	}
+	instruction.Command = strings.TrimSpace(parts[1])
+	return instruction, nil
+}
+
+// parseKeyValues parses the `key=value` words of an ENV or LABEL instruction. The legacy
+// `key value` form, in which the value is the rest of the words, is accepted as well.
+func parseKeyValues(words []string) ([]KeyValue, error) {
+	if len(words) == 0 {
+		return nil, errors.New("at least one key and value required")
+	}
+	if !strings.Contains(words[0], "=") {
+		if len(words) < 2 {
+			return nil, errors.Errorf("no value given for %s", words[0])
+		}
+		return []KeyValue{{Key: words[0], Value: strings.Join(words[1:], " ")}}, nil
+	}
+
+	var keyValues []KeyValue
+	for _, word := range words {
+		parts := strings.SplitN(word, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid key value pair %q", word)
+		}
+		keyValues = append(keyValues, KeyValue{Key: parts[0], Value: parts[1]})
+	}
+	return keyValues, nil
+}
+
+// renderKeyValues renders the pairs as `key=value` words, quoting each key and value if required.
+func renderKeyValues(keyValues []KeyValue) string {
+	var words []string
+	for _, keyValue := range keyValues {
+		words = append(words, quoteWord(keyValue.Key)+"="+quoteWord(keyValue.Value))
+	}
+	return strings.Join(words, " ")
+}
+
+// validateKeyValues checks that there is at least one pair, and that the keys
+// are non empty and none of the keys and values span lines.
+func validateKeyValues(kind string, keyValues []KeyValue) error {
+	if len(keyValues) == 0 {
+		return errors.Errorf("at least one %s required", kind)
+	}
+	for _, keyValue := range keyValues {
+		if keyValue.Key == "" || strings.ContainsAny(keyValue.Key, "=\n\r") {
+			return errors.Errorf("invalid %s name %q", kind, keyValue.Key)
+		}
+		if strings.ContainsAny(keyValue.Value, "\n\r") {
+			return errors.Errorf("value of %s %s spans several lines", kind, keyValue.Key)
+		}
+	}
+	return nil
+}
+
+// validateCommand checks that the shell command is given on a single line.
+func validateCommand(command string) error {
+	if strings.TrimSpace(command) == "" {
+		return errors.New("command not provided")
+	}
+	if strings.ContainsAny(command, "\n\r") {
+		return errors.Errorf("command %q spans several lines", command)
+	}
+	return nil
+}
+
+// quoteWord returns the word as is if it only holds plain characters, otherwise it returns the word
+// in double quotes, escaping the backslashes, double quotes and `$` to prevent variable substitution.
+func quoteWord(word string) string {
+	if plainWordPattern.MatchString(word) {
+		return word
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + escaper.Replace(word) + `"`
+}
+
+// splitWords splits the arguments into words separated by whitespace, in the same way as
+// docker does. Within double quotes and outside of quotes a backslash escapes the following
+// character, while single quotes preserve the literal value of the characters they enclose.
+func splitWords(arguments string) ([]string, error) {
+	var words []string
+	word := &strings.Builder{}
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, char := range arguments {
+		switch {
+		case escaped:
+			word.WriteRune(char)
+			escaped = false
+		case quote == '\'':
+			if char == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(char)
+			}
+		case char == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if char == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(char)
+			}
+		case char == '"' || char == '\'':
+			quote, inWord = char, true
+		case char == ' ' || char == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(char)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote or escape in %q", arguments)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,187 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/constants"
+	"assignment-exec/image-builder/environment"
+	"assignment-exec/image-builder/scripts"
+	"assignment-exec/image-builder/utilities/shell"
+	"path"
+	"strings"
+)
+
+// The build stage installing the languages and libraries in a multi-stage build is named buildStageName.
+// To measure its size, it is built on its own as an image whose tag is suffixed with buildStageTagSuffix.
+const (
+	buildStageName      = "build"
+	buildStageTagSuffix = "-build-stage"
+)
+
+// getBaseImageInstructions returns the instructions starting from the given reference of the
+// base image, which copy the installation scripts, install and verify every language, declare
+// the supported languages to the code-runner and install the libraries.
+func getBaseImageInstructions(config *configurations.AssignmentEnvConfig, baseImage string) ([]Instruction, error) {
+	instructions := []Instruction{&FromInstruction{Image: baseImage}}
+	instructions = append(instructions, getBuildArgInstructions(config)...)
+	instructions = append(instructions, getCopyScriptsInstruction(config))
+	for _, lang := range config.Deps.Languages {
+		instructions = append(instructions, getInstallInstruction(lang))
+		if verification := lang.GetVerifyCommand(); verification != "" {
+			instructions = append(instructions, &RunInstruction{Command: verification})
+		}
+	}
+	instructions = append(instructions, getSupportedLanguagesInstruction(config))
+	libraryInstructions, err := getLibraryInstructions(config)
+	if err != nil {
+		return nil, err
+	}
+	return append(instructions, libraryInstructions...), nil
+}
+
+// getInstallInstruction returns the instruction running the installation script of the language.
+// The package lists downloaded by a script that uses apt are removed in the same layer.
+func getInstallInstruction(lang configurations.LanguageInfo) Instruction {
+	command := lang.GetInstallCommand()
+	if script, found := scripts.Default().Get(lang.Name, lang.Version); found && script.RequiresApt() {
+		command += " && " + constants.AptListsCleanupCmd
+	}
+	return &RunInstruction{Command: command}
+}
+
+// getSupportedLanguagesInstruction returns the instruction declaring the supported languages to the code-runner.
+func getSupportedLanguagesInstruction(config *configurations.AssignmentEnvConfig) Instruction {
+	return &EnvInstruction{Variables: []KeyValue{
+		{Key: environment.LanguageEnvKey, Value: config.Deps.GetSupportedLanguages()}}}
+}
+
+// getMultiStageInstructions turns the given instructions into the build stage of a multi-stage build,
+// which is followed by the final stage starting from the given reference of the base image. The final
+// stage installs the runtime packages, copies the runtime artifacts from the build stage, declares the
+// supported languages, verifies that every language runs and installs the libraries again, as the files
+// that the libraries install are not known.
+func getMultiStageInstructions(config *configurations.AssignmentEnvConfig, buildStage []Instruction,
+	baseImage string) ([]Instruction, error) {
+	from := *buildStage[0].(*FromInstruction)
+	from.Stage = buildStageName
+	instructions := append([]Instruction{&from}, buildStage[1:]...)
+
+	instructions = append(instructions, &FromInstruction{Image: baseImage})
+	instructions = append(instructions, getBuildArgInstructions(config)...)
+	if packages := config.MultiStage.GetPackages(config.Deps.Languages); len(packages) > 0 {
+		instructions = append(instructions, getPackagesInstruction(packages))
+	}
+	for _, artifact := range config.MultiStage.GetArtifacts(config.Deps.Languages) {
+		// The files matched by a glob are copied into the directory of the glob.
+		destination := artifact
+		if strings.ContainsAny(artifact, "*?[") {
+			destination = path.Dir(artifact) + "/"
+		}
+		instructions = append(instructions, &CopyInstruction{
+			Sources: []string{artifact}, Destination: destination, From: buildStageName})
+	}
+	instructions = append(instructions, getSupportedLanguagesInstruction(config))
+	for _, lang := range config.Deps.Languages {
+		if verification := lang.GetVerifyCommand(); verification != "" {
+			instructions = append(instructions, &RunInstruction{Command: verification})
+		}
+	}
+	libraryInstructions, err := getLibraryInstructions(config)
+	if err != nil {
+		return nil, err
+	}
+	return append(instructions, libraryInstructions...), nil
+}
+
+// getPackagesInstruction returns the instruction installing the given apt packages,
+// whose package lists are removed in the same layer.
+func getPackagesInstruction(packages []string) Instruction {
+	var quoted []string
+	for _, pkg := range packages {
+		quoted = append(quoted, shell.Quote(pkg))
+	}
+	return &RunInstruction{Command: "apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get install -y " +
+		"--no-install-recommends " + strings.Join(quoted, " ") + " && " + constants.AptListsCleanupCmd}
+}
+
+// getLanguageImageInstructions returns the instructions starting from the given reference
+// of the language image, which install the libraries.
+func getLanguageImageInstructions(config *configurations.AssignmentEnvConfig, languageImage string) ([]Instruction, error) {
+	instructions := []Instruction{&FromInstruction{Image: languageImage}}
+	instructions = append(instructions, getBuildArgInstructions(config)...)
+	libraryInstructions, err := getLibraryInstructions(config)
+	if err != nil {
+		return nil, err
+	}
+	return append(instructions, libraryInstructions...), nil
+}
+
+// getCopyScriptsInstruction returns the instruction copying the installation script of every
+// language from the build context to the scripts directory within the code-runner directory.
+func getCopyScriptsInstruction(config *configurations.AssignmentEnvConfig) Instruction {
+	var sources []string
+	for _, script := range getReferencedScripts(config) {
+		sources = append(sources, path.Join(constants.InstallationScriptsDir, script.Name))
+	}
+	return &CopyInstruction{Sources: sources,
+		Destination: path.Join("/", constants.CodeRunnerDir, constants.InstallationScriptsDir) + "/"}
+}
+
+// getLibraryInstructions returns the instruction installing each library,
+// in the sorted order of the library names.
+func getLibraryInstructions(config *configurations.AssignmentEnvConfig) ([]Instruction, error) {
+	commands, err := config.Deps.GetLibraryCommands()
+	if err != nil {
+		return nil, err
+	}
+	var instructions []Instruction
+	for _, command := range commands {
+		instructions = append(instructions, &RunInstruction{Command: command})
+	}
+	return instructions, nil
+}
+
+// getBuildArgInstructions returns the instruction declaring each build argument, in the sorted order
+// of their names, so that the installation scripts and libraries are given their values by the build.
+func getBuildArgInstructions(config *configurations.AssignmentEnvConfig) []Instruction {
+	var instructions []Instruction
+	for _, name := range config.GetBuildArgNames() {
+		instructions = append(instructions, &ArgInstruction{Name: name})
+	}
+	return instructions
+}
+
+// getRuntimeInstructions returns the instructions setting the environment variables, in the sorted
+// order of their names, and the working directory of the container. They follow the installation of
+// the languages and libraries, which are therefore not installed again once they change.
+func getRuntimeInstructions(config *configurations.AssignmentEnvConfig) []Instruction {
+	var instructions []Instruction
+	if len(config.Env) > 0 {
+		var variables []KeyValue
+		for _, name := range config.GetEnvNames() {
+			variables = append(variables, KeyValue{Key: name, Value: config.Env[name]})
+		}
+		instructions = append(instructions, &EnvInstruction{Variables: variables})
+	}
+	if config.Workdir != "" {
+		instructions = append(instructions, &WorkdirInstruction{Path: config.Workdir})
+	}
+	return instructions
+}
+
+// getAssetInstructions returns the instruction copying the files of each asset from the build context.
+// The assets are copied last, in the sorted order of their destinations and sources, so that changing
+// an asset does not install the languages and libraries again and that the order in which the assets
+// are declared does not invalidate the build cache.
+func getAssetInstructions(assets []configurations.ResolvedAsset) []Instruction {
+	var instructions []Instruction
+	for _, asset := range assets {
+		var sources []string
+		for _, file := range asset.Files {
+			sources = append(sources, getAssetContextPath(file))
+		}
+		instructions = append(instructions, &CopyInstruction{Sources: sources, Destination: asset.Destination, Chown: asset.Owner})
+	}
+	return instructions
+}
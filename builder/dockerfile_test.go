@@ -0,0 +1,140 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// updateGolden regenerates the golden files of the dockerfile tests instead of comparing against them.
+var updateGolden = flag.Bool("update", false, "Update the golden files in testdata")
+
+// assertGolden compares the dockerfile with the named golden file, and checks that
+// the dockerfile parsed back from its rendering renders the same.
+func assertGolden(t *testing.T, name string, dockerfile *Dockerfile) {
+	golden := filepath.Join("testdata", name)
+	rendered := dockerfile.String()
+	if *updateGolden {
+		assert.NoError(t, ioutil.WriteFile(golden, []byte(rendered), 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), rendered)
+
+	parsed, err := ParseDockerfile(rendered)
+	assert.NoError(t, err)
+	assert.Equal(t, dockerfile, parsed)
+	assert.Equal(t, rendered, parsed.String())
+}
+
+// TestAssignmentEnvDockerfile tests the dockerfiles generated for assignment
+// environment configurations against their golden files.
+func TestAssignmentEnvDockerfile(t *testing.T) {
+	goldenConfigs := map[string]string{
+		"gcc7.Dockerfile": "baseImage: assignmentexec/code-runner:1.0\n" +
+			"dependencies:\n  lang: gcc\n  langVersion: 7\n",
+		"multiLanguage.Dockerfile": "baseImage: assignmentexec/code-runner:1.0\n" +
+			"dependencies:\n  languages:\n    - lang: python\n      langVersion: 3.7\n" +
+			"    - lang: gcc\n      langVersion: 7\n" +
+			"  lib:\n    numpy:\n      manager: pip\n      version: \"1.18.*\"\n" +
+			"    graphviz:\n      manager: apt\n",
+	}
+	for name, data := range goldenConfigs {
+		config := &configurations.AssignmentEnvConfig{}
+		assert.NoError(t, yaml.Unmarshal([]byte(data), config))
+		instructions, err := getBaseImageInstructions(config, config.BaseImage)
+		assert.NoError(t, err)
+		dockerfile := NewDockerfile(instructions...)
+		assert.NoError(t, dockerfile.Validate())
+		assertGolden(t, name, dockerfile)
+	}
+
+	config := &configurations.AssignmentEnvConfig{}
+	assert.NoError(t, yaml.Unmarshal([]byte(goldenConfigs["multiLanguage.Dockerfile"]), config))
+	instructions, err := getLanguageImageInstructions(config, "assignmentexec/python3.7-gcc7@sha256:abc")
+	assert.NoError(t, err)
+	assertGolden(t, "languageImage.Dockerfile", NewDockerfile(instructions...))
+
+	// The final stage installs the runtime packages of gcc and the libraries again.
+	assert.NoError(t, yaml.Unmarshal([]byte(goldenConfigs["gcc7.Dockerfile"]+
+		"  lib:\n    zlib1g-dev:\n      manager: apt\n"+
+		"multiStage:\n  enabled: true\n  artifacts:\n    - /usr/share/gcc-*\n"), config))
+	instructions, err = getBaseImageInstructions(config, config.BaseImage)
+	assert.NoError(t, err)
+	instructions, err = getMultiStageInstructions(config, instructions, config.BaseImage)
+	assert.NoError(t, err)
+	dockerfile := NewDockerfile(instructions...)
+	assert.NoError(t, dockerfile.Validate())
+	assertGolden(t, "multiStage.Dockerfile", dockerfile)
+
+	// A library of an unsupported manager is refused even if the configuration was not validated.
+	config.Deps.Libraries = map[string]configurations.LibInstallationCmd{"numpy": {Manager: "conda"}}
+	_, err = getBaseImageInstructions(config, config.BaseImage)
+	assert.EqualError(t, err, "library manager conda of library numpy not supported")
+}
+
+// TestDockerfileInstructions tests the quoting and escaping of every instruction,
+// and parsing dockerfiles that are not in the canonical format.
+func TestDockerfileInstructions(t *testing.T) {
+	dockerfile := NewDockerfile(
+		&FromInstruction{Image: "golang:1.16", Stage: "build"},
+		&ArgInstruction{Name: "GOPROXY"},
+		&ArgInstruction{Name: "GOFLAGS", Default: "-mod=vendor -trimpath"},
+		&WorkdirInstruction{Path: "/src/my project"},
+		&CopyInstruction{Sources: []string{"main.go", "go.mod"}, Destination: "./"},
+		&RunInstruction{Command: `go build -ldflags "-s -w" -o /app .`},
+		&FromInstruction{Image: "assignmentexec/code-runner:1.0"},
+		&CopyInstruction{Sources: []string{"/app"}, Destination: "/usr/local/bin/app", From: "build"},
+		&CopyInstruction{Sources: []string{"hello world.txt", `quote".txt`}, Destination: "/data/", Chown: "1000:1000"},
+		&EnvInstruction{Variables: []KeyValue{{Key: "PATH", Value: "$PATH:/opt/bin"}, {Key: "GREETING", Value: `say "hi" \o/`}}},
+		&EnvInstruction{Variables: []KeyValue{{Key: "EMPTY", Value: ""}}},
+		&LabelInstruction{Labels: []KeyValue{{Key: "org.assignment-exec.language", Value: "gcc 7"}}},
+		&UserInstruction{User: "runner"},
+		&HealthcheckInstruction{Command: "curl -f http://localhost:52453/health || exit 1",
+			Interval: 30 * time.Second, Timeout: 5 * time.Second, Retries: 3},
+		&HealthcheckInstruction{},
+	)
+	assert.NoError(t, dockerfile.Validate())
+	assertGolden(t, "instructions.Dockerfile", dockerfile)
+
+	parsed, err := ParseDockerfile("# Legacy forms\n\nfrom ubuntu:20.04\n" +
+		"ENV SUPPORTED_LANGUAGE gcc,java\nrun apt-get update && \\\n    apt-get install -y gcc\n" +
+		"LABEL 'key'=\"a \\\"b\\\"\" other=c\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "FROM ubuntu:20.04\nENV SUPPORTED_LANGUAGE=gcc,java\n"+
+		"RUN apt-get update &&  apt-get install -y gcc\nLABEL key=\"a \\\"b\\\"\" other=c\n", parsed.String())
+
+	invalidDockerfiles := map[string]string{
+		"FROM ubuntu\nEXPOSE 80\n":            "error in line 2: unsupported instruction EXPOSE",
+		"FROM ubuntu\nENV KEY=\"value\n":      "error in line 2: unterminated quote or escape in \"KEY=\\\"value\"",
+		"FROM ubuntu\nCOPY src\n":             "error in line 2: COPY requires at least one source and a destination",
+		"FROM ubuntu\nHEALTHCHECK curl\n":     "error in line 2: HEALTHCHECK requires NONE or a CMD",
+		"FROM ubuntu\nCOPY --chmod=755 a b\n": "error in line 2: unsupported COPY flag --chmod",
+		"FROM ubuntu\nARG A B\n":              "error in line 2: ARG requires a single argument",
+	}
+	for text, expectedErr := range invalidDockerfiles {
+		_, err := ParseDockerfile(text)
+		assert.EqualError(t, err, expectedErr)
+	}
+
+	invalidInstructions := map[Instruction]string{
+		&RunInstruction{Command: "echo a\necho b"}:          "invalid RUN instruction 2: command \"echo a\\necho b\" spans several lines",
+		&EnvInstruction{}:                                   "invalid ENV instruction 2: at least one environment variable required",
+		&UserInstruction{User: "my user"}:                   "invalid USER instruction 2: invalid user \"my user\"",
+		&HealthcheckInstruction{Retries: 3}:                 "invalid HEALTHCHECK instruction 2: health check options given without a command",
+		&LabelInstruction{Labels: []KeyValue{{Value: "x"}}}: "invalid LABEL instruction 2: invalid label name \"\"",
+	}
+	for instruction, expectedErr := range invalidInstructions {
+		err := NewDockerfile(&FromInstruction{Image: "ubuntu"}, instruction).Validate()
+		assert.EqualError(t, err, expectedErr)
+	}
+	assert.EqualError(t, NewDockerfile(&RunInstruction{Command: "true"}).Validate(),
+		"dockerfile does not start with a FROM instruction")
+}
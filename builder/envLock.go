@@ -0,0 +1,140 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/registry"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// ErrPinnedImageNotFound is returned when an image pinned by the lock file
+// is no longer present in its registry.
+var ErrPinnedImageNotFound = errors.New("pinned image not found")
+
+// withEnvLockFilepath returns an assignmentEnvironmentImageBuilderOption for initializing
+// the location of the lock file of the configuration and reading the lock file, if present.
+func withEnvLockFilepath(lockFilepath string) assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		if lockFilepath == "" {
+			return errors.New("lock file location not provided")
+		}
+		lock, err := configurations.ReadEnvLock(lockFilepath)
+		if err != nil {
+			return err
+		}
+		asgmtEnv.envLockFilepath = lockFilepath
+		asgmtEnv.envLock = lock
+		return nil
+	}
+}
+
+// WithEnvLockUpdate returns an assignmentEnvironmentImageBuilderOption for ignoring
+// the digests pinned by the lock file, so that the base image and language image
+// are resolved again and the lock file is refreshed.
+func WithEnvLockUpdate() assignmentEnvironmentImageBuilderOption {
+	return func(asgmtEnv *assignmentEnvironmentImageBuilder) error {
+		asgmtEnv.updateEnvLock = true
+		return nil
+	}
+}
+
+// getLockedImages returns the images pinned by the lock file. It returns nil if there is
+// no lock file or if the lock file is being updated, in which case the images are resolved again.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getLockedImages() *configurations.EnvLock {
+	if asgmtEnv.updateEnvLock {
+		return nil
+	}
+	return asgmtEnv.envLock
+}
+
+// verifyPinnedImage checks whether the image pinned by the lock file to the given digest
+// is still present in its registry.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) verifyPinnedImage(ctx context.Context, reference string, digest string) error {
+	image := registry.ParseReference(getPinnedReference(reference, digest))
+	_, err := asgmtEnv.registryClient.Resolve(ctx, image)
+	if registry.IsNotFound(err) {
+		return errors.Wrapf(ErrPinnedImageNotFound, "image %s, run `image-builder update` to refresh the lock file", image)
+	}
+	return err
+}
+
+// getBaseImageSource returns the reference of the base image that the dockerfile starts
+// from, which is pinned by its digest if the configuration has a lock file.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getBaseImageSource() string {
+	if asgmtEnv.envLockFilepath == "" {
+		return asgmtEnv.AsgmtEnvConfig.BaseImage
+	}
+	return getPinnedReference(asgmtEnv.AsgmtEnvConfig.BaseImage, asgmtEnv.BaseImageDigest)
+}
+
+// getLanguageImageSource returns the reference of the language image that the dockerfile starts
+// from, which is pinned by its digest if the configuration has a lock file.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getLanguageImageSource() string {
+	if asgmtEnv.envLockFilepath == "" {
+		return asgmtEnv.LanguageImageRef
+	}
+	return getPinnedReference(asgmtEnv.LanguageImageRef, asgmtEnv.LanguageImageDigest)
+}
+
+// getResolvedEnvLock returns the lock pinning the base image and language image to the digests
+// resolved by the verification. It returns false if the lock file already pins these digests.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getResolvedEnvLock() (*configurations.EnvLock, bool) {
+	lock := &configurations.EnvLock{
+		BaseImage: configurations.PinnedImage{
+			Reference: asgmtEnv.AsgmtEnvConfig.BaseImage,
+			Digest:    asgmtEnv.BaseImageDigest},
+		LanguageImage: configurations.PinnedImage{
+			Reference: asgmtEnv.LanguageImageRef,
+			Digest:    asgmtEnv.LanguageImageDigest},
+	}
+	if asgmtEnv.envLock != nil && *asgmtEnv.envLock == *lock {
+		return lock, false
+	}
+	return lock, true
+}
+
+// writeEnvLock writes the digests resolved by the verification to the lock file of the
+// configuration, if any, unless the lock file already pins these digests.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) writeEnvLock() error {
+	if asgmtEnv.envLockFilepath == "" {
+		return nil
+	}
+	lock, changed := asgmtEnv.getResolvedEnvLock()
+	if !changed {
+		return nil
+	}
+	if err := lock.Write(asgmtEnv.envLockFilepath); err != nil {
+		return err
+	}
+	asgmtEnv.envLock = lock
+	return asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "verify",
+		Message: fmt.Sprintf("Pinned base image %s in %s", getPinnedReference(lock.BaseImage.Reference,
+			lock.BaseImage.Digest), asgmtEnv.envLockFilepath)})
+}
+
+// WarnIgnoredEnvLock renders a warning if the config file has a lock file, which the given
+// kind of build, e.g a matrix build, does not use to pin the base image and language image.
+func WarnIgnoredEnvLock(renderer ProgressRenderer, configFilepath string, build string) error {
+	lockFilepath := configurations.GetEnvLockFilepath(configFilepath)
+	if _, err := os.Stat(lockFilepath); err != nil {
+		return nil
+	}
+	return renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "verify",
+		Message: fmt.Sprintf("Warning: lock file %s is ignored by %s, the base image and language image "+
+			"are not pinned by digest", lockFilepath, build)})
+}
+
+// getPinnedReference returns the image reference with its tag replaced by the given digest.
+// The reference is returned as is if the digest is unknown.
+func getPinnedReference(reference string, digest string) string {
+	if digest == "" {
+		return reference
+	}
+	image := registry.ParseReference(reference)
+	image.Tag = digest
+	return image.String()
+}
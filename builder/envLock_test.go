@@ -0,0 +1,94 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/configurations"
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEnvLock tests that the lock file pins the base image and language image
+// resolved by the first build, that rendering does not write it and that the update refreshes it.
+func TestEnvLock(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	execute := func(commands func(*assignmentEnvironmentImageBuilder, *bytes.Buffer) BuildManagerOption,
+		options ...assignmentEnvironmentImageBuilderOption) (string, error) {
+		options = append(options, WithContainerEngine(env.engine),
+			WithProgressRenderer(&plainRenderer{writer: ioutil.Discard}))
+		asgmtEnv, err := GetConfigurations(false, "", env.configFile, env.dockerfileLoc, options...)
+		if err != nil {
+			return "", err
+		}
+		output := &bytes.Buffer{}
+		buildManager, err := NewBuildManager(commands(asgmtEnv, output))
+		if err != nil {
+			return "", err
+		}
+		err = buildManager.ExecuteCommands(context.Background())
+		return strings.SplitN(output.String(), "\n", 2)[0], err
+	}
+	render := func(asgmtEnv *assignmentEnvironmentImageBuilder, output *bytes.Buffer) BuildManagerOption {
+		return WithRenderCommands(asgmtEnv, output)
+	}
+	update := func(asgmtEnv *assignmentEnvironmentImageBuilder, _ *bytes.Buffer) BuildManagerOption {
+		return WithUpdateCommands(asgmtEnv)
+	}
+	build := func(asgmtEnv *assignmentEnvironmentImageBuilder, _ *bytes.Buffer) BuildManagerOption {
+		return WithBuildCommands(asgmtEnv)
+	}
+
+	from, err := execute(render)
+	assert.NoError(t, err)
+	assert.Equal(t, "FROM "+env.registry+"/assignmentexec/code-runner@sha256:code-runner", from)
+	lockFilepath := filepath.Join(filepath.Dir(env.configFile), "assignment-env.lock")
+	_, err = os.Stat(lockFilepath)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = execute(build)
+	assert.NoError(t, err)
+	lock, err := configurations.ReadEnvLock(lockFilepath)
+	assert.NoError(t, err)
+	assert.Equal(t, configurations.PinnedImage{Reference: env.registry + "/assignmentexec/code-runner:1.0",
+		Digest: "sha256:code-runner"}, lock.BaseImage)
+	assert.Equal(t, env.registry+"/assignmentexec/gcc7:latest", lock.LanguageImage.Reference)
+	assert.Empty(t, lock.LanguageImage.Digest)
+
+	// The tags move on, but the locked images are still used.
+	env.engine.RemoteImages["assignmentexec/code-runner:previous"] = env.engine.RemoteImages["assignmentexec/code-runner:1.0"]
+	env.engine.RemoteImages["assignmentexec/code-runner:1.0"] = &containers.ImageInfo{ID: "sha256:code-runner-2"}
+	env.engine.RemoteImages["assignmentexec/gcc7:latest"] = &containers.ImageInfo{ID: "sha256:gcc7"}
+	from, err = execute(render)
+	assert.NoError(t, err)
+	assert.Equal(t, "FROM "+env.registry+"/assignmentexec/code-runner@sha256:code-runner", from)
+
+	// Rendering with the update does not refresh the lock file, which only the update subcommand does.
+	from, err = execute(render, WithEnvLockUpdate())
+	assert.NoError(t, err)
+	assert.Contains(t, from, env.registry+"/assignmentexec/gcc7:latest already exists")
+	lock, err = configurations.ReadEnvLock(lockFilepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:code-runner", lock.BaseImage.Digest)
+
+	// The update resolves the images again and refreshes the lock file.
+	_, err = execute(update, WithEnvLockUpdate())
+	assert.NoError(t, err)
+	lock, err = configurations.ReadEnvLock(lockFilepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:code-runner-2", lock.BaseImage.Digest)
+	assert.Equal(t, "sha256:gcc7", lock.LanguageImage.Digest)
+
+	// A locked image that is no longer in the registry is not silently replaced.
+	delete(env.engine.RemoteImages, "assignmentexec/gcc7:latest")
+	_, err = execute(render)
+	assert.Equal(t, ErrPinnedImageNotFound, errors.Cause(err))
+}
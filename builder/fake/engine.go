@@ -0,0 +1,425 @@
+// Package fake implements an in-memory container engine and registry,
+// which the tests of the packages building images run against.
+package fake
+
+import (
+	"archive/tar"
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/registry"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Engine is an in-memory containers.ContainerEngine implementation that can be
+// used to run the build pipeline without a docker daemon or a registry.
+//
+// Local and remote images are keyed by their `repository:tag` reference without
+// the registry host. The dockerfile, the names of the files of the build context
+// and the build arguments of every built image are kept under the same key.
+// An operation fails with the error stored in Failures against its method name,
+// e.g "BuildImage", while the progress stream of an operation reports the daemon
+// side error stored in StreamErrors against its method name. The remote images are
+// served through the Docker Registry HTTP API v2 by the handler returned by
+// RegistryHandler.
+//
+// A container exits with the result stored in ContainerResults against a text that its
+// command contains, or else with exit code 0 and no output. A container started in the
+// background is served by the CodeRunnerHandler, if any, or else by a handler that
+// responds with 200 OK to every request.
+//
+// The size of a built image is the sum of the sizes of the layers of its last stage.
+// A layer has the size stored in LayerSizes against a text that its instruction
+// contains, or else the length of its instruction.
+type Engine struct {
+	mutex             sync.Mutex
+	LocalImages       map[string]*containers.ImageInfo
+	RemoteImages      map[string]*containers.ImageInfo
+	Dockerfiles       map[string]string
+	BuildContexts     map[string][]string
+	BuildArgs         map[string]map[string]string
+	LayerSizes        map[string]int64
+	Failures          map[string]error
+	StreamErrors      map[string]string
+	ContainerResults  map[string]containers.ContainerResult
+	CodeRunnerHandler http.Handler
+	Calls             []string
+	containers        map[string]*httptest.Server
+}
+
+// NewEngine creates an empty Engine.
+func NewEngine() *Engine {
+	return &Engine{
+		LocalImages:      make(map[string]*containers.ImageInfo),
+		RemoteImages:     make(map[string]*containers.ImageInfo),
+		Dockerfiles:      make(map[string]string),
+		BuildContexts:    make(map[string][]string),
+		BuildArgs:        make(map[string]map[string]string),
+		LayerSizes:       make(map[string]int64),
+		Failures:         make(map[string]error),
+		StreamErrors:     make(map[string]string),
+		ContainerResults: make(map[string]containers.ContainerResult),
+		containers:       make(map[string]*httptest.Server),
+	}
+}
+
+// record stores the invoked operation and returns the error of the context,
+// if it is done, or else the failure configured for the operation, if any.
+func (engine *Engine) record(ctx context.Context, operation string, ref string) error {
+	engine.Calls = append(engine.Calls, fmt.Sprintf("%s %s", operation, ref))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return engine.Failures[operation]
+}
+
+// BuildImage reads the dockerfile from the build context tar and stores
+// a local image for each of the given tags.
+func (engine *Engine) BuildImage(ctx context.Context, buildContext io.Reader, options containers.ImageBuildOptions) (io.ReadCloser, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "BuildImage", strings.Join(options.Tags, ",")); err != nil {
+		return nil, err
+	}
+
+	dockerfile, contextFiles, err := readBuildContext(buildContext, options.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	if message, found := engine.StreamErrors["BuildImage"]; found {
+		return newErrorStream(message)
+	}
+	dockerfile = GetLastStage(dockerfile)
+	sum := sha256.Sum256([]byte(dockerfile))
+	image := &containers.ImageInfo{
+		ID:       "sha256:" + hex.EncodeToString(sum[:]),
+		RepoTags: options.Tags,
+		Labels:   options.Labels,
+		Size:     engine.GetSize(dockerfile),
+	}
+
+	// An image built from a local image holds the dockerfiles of both, like the layers of the image.
+	if from := strings.Fields(strings.SplitN(dockerfile, "\n", 2)[0]); len(from) == 2 && from[0] == "FROM" {
+		if base, found := engine.Dockerfiles[ImageKey(from[1])]; found {
+			dockerfile = base + dockerfile
+		}
+	}
+	var messages []interface{}
+	for _, tag := range options.Tags {
+		engine.LocalImages[ImageKey(tag)] = image
+		engine.Dockerfiles[ImageKey(tag)] = dockerfile
+		engine.BuildContexts[ImageKey(tag)] = contextFiles
+		engine.BuildArgs[ImageKey(tag)] = options.BuildArgs
+	}
+	messages = append(messages, map[string]string{"stream": fmt.Sprintf("Successfully built %s\n", image.ID)})
+	for _, tag := range options.Tags {
+		messages = append(messages, map[string]string{"stream": fmt.Sprintf("Successfully tagged %s\n", tag)})
+	}
+	return newMessageStream(messages...)
+}
+
+// PushImage copies the local image with the given reference to the remote images.
+func (engine *Engine) PushImage(ctx context.Context, ref string, _ string) (io.ReadCloser, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "PushImage", ref); err != nil {
+		return nil, err
+	}
+
+	key := ImageKey(ref)
+	image, found := engine.LocalImages[key]
+	if !found {
+		return nil, errors.Errorf("no such image: %s", ref)
+	}
+	if message, found := engine.StreamErrors["PushImage"]; found {
+		return newErrorStream(message)
+	}
+	engine.RemoteImages[key] = image
+	return newMessageStream(
+		map[string]string{"status": fmt.Sprintf("The push refers to a repository [%s]", ref)},
+		map[string]string{"status": fmt.Sprintf("%s: digest: %s", key, image.ID)})
+}
+
+// PullImage copies the remote image with the given reference to the local images.
+func (engine *Engine) PullImage(ctx context.Context, ref string, _ string) (io.ReadCloser, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "PullImage", ref); err != nil {
+		return nil, err
+	}
+
+	key := ImageKey(ref)
+	image, found := engine.RemoteImages[key]
+	if !found {
+		return nil, errors.Errorf("repository %s not found", ref)
+	}
+	if message, found := engine.StreamErrors["PullImage"]; found {
+		return newErrorStream(message)
+	}
+	engine.LocalImages[key] = image
+	return newMessageStream(
+		map[string]string{"status": fmt.Sprintf("Digest: %s", image.ID)},
+		map[string]string{"status": fmt.Sprintf("Status: Downloaded newer image for %s", ref)})
+}
+
+// RemoveImage removes the local image with the given reference.
+func (engine *Engine) RemoveImage(ctx context.Context, ref string) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "RemoveImage", ref); err != nil {
+		return err
+	}
+
+	key := ImageKey(ref)
+	if _, found := engine.LocalImages[key]; !found {
+		return errors.Errorf("no such image: %s", ref)
+	}
+	delete(engine.LocalImages, key)
+	return nil
+}
+
+// InspectImage returns the local image with the given reference.
+func (engine *Engine) InspectImage(ctx context.Context, ref string) (*containers.ImageInfo, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "InspectImage", ref); err != nil {
+		return nil, err
+	}
+
+	image, found := engine.LocalImages[ImageKey(ref)]
+	if !found {
+		return nil, errors.Errorf("no such image: %s", ref)
+	}
+	return image, nil
+}
+
+// ListImages returns the local images that carry the given label, each
+// with the key of the image as its only tag.
+func (engine *Engine) ListImages(ctx context.Context, label string) ([]containers.ImageInfo, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "ListImages", label); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, image := range engine.LocalImages {
+		if _, found := image.Labels[label]; found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var images []containers.ImageInfo
+	for _, key := range keys {
+		image := *engine.LocalImages[key]
+		image.RepoTags = []string{key}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// RunContainer returns the result stored against a text contained by the command,
+// if any, provided that the image with the given reference is present locally.
+func (engine *Engine) RunContainer(ctx context.Context, ref string, cmd []string) (*containers.ContainerResult, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "RunContainer", ref); err != nil {
+		return nil, err
+	}
+
+	if _, found := engine.LocalImages[ImageKey(ref)]; !found {
+		return nil, errors.Errorf("no such image: %s", ref)
+	}
+	command := strings.Join(cmd, " ")
+	for text, result := range engine.ContainerResults {
+		if strings.Contains(command, text) {
+			result := result
+			return &result, nil
+		}
+	}
+	return &containers.ContainerResult{}, nil
+}
+
+// StartContainer serves the code-runner handler on a random port of the loopback
+// address, provided that the image with the given reference is present locally.
+func (engine *Engine) StartContainer(ctx context.Context, ref string, args []string, _ int) (*containers.RunningContainer, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "StartContainer", ref+" "+strings.Join(args, " ")); err != nil {
+		return nil, err
+	}
+
+	if _, found := engine.LocalImages[ImageKey(ref)]; !found {
+		return nil, errors.Errorf("no such image: %s", ref)
+	}
+	handler := engine.CodeRunnerHandler
+	if handler == nil {
+		handler = http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+			writer.WriteHeader(http.StatusOK)
+		})
+	}
+	server := httptest.NewServer(handler)
+	id := fmt.Sprintf("container-%d", len(engine.Calls))
+	engine.containers[id] = server
+	return &containers.RunningContainer{ID: id, Address: server.Listener.Addr().String()}, nil
+}
+
+// StopContainer stops serving the container with the given ID.
+func (engine *Engine) StopContainer(ctx context.Context, id string) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	if err := engine.record(ctx, "StopContainer", id); err != nil {
+		return err
+	}
+
+	server, found := engine.containers[id]
+	if !found {
+		return errors.Errorf("no such container: %s", id)
+	}
+	server.Close()
+	delete(engine.containers, id)
+	return nil
+}
+
+// RegistryHandler returns an http handler serving the manifests of the remote
+// images through the Docker Registry HTTP API v2, so that the engine can stand in
+// for the registry as well. The image ID is served as the manifest digest.
+func (engine *Engine) RegistryHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/v2/" {
+			writer.WriteHeader(http.StatusOK)
+			return
+		}
+
+		path := strings.TrimPrefix(request.URL.Path, "/v2/")
+		index := strings.LastIndex(path, "/manifests/")
+		if index < 0 || !strings.HasPrefix(request.URL.Path, "/v2/") {
+			http.NotFound(writer, request)
+			return
+		}
+		repository, tag := path[:index], path[index+len("/manifests/"):]
+
+		engine.mutex.Lock()
+		image, found := engine.RemoteImages[strings.TrimPrefix(repository, "library/")+":"+tag]
+		// An image referenced by digest is looked up by its ID among the tags of the repository.
+		for key, remoteImage := range engine.RemoteImages {
+			if !found && remoteImage.ID == tag && strings.HasPrefix(key, strings.TrimPrefix(repository, "library/")+":") {
+				image, found = remoteImage, true
+			}
+		}
+		engine.mutex.Unlock()
+		if !found {
+			http.NotFound(writer, request)
+			return
+		}
+
+		manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q}}`, image.ID))
+		writer.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		writer.Header().Set("Docker-Content-Digest", image.ID)
+		writer.Header().Set("Content-Length", fmt.Sprint(len(manifest)))
+		writer.WriteHeader(http.StatusOK)
+		if request.Method != http.MethodHead {
+			_, _ = writer.Write(manifest)
+		}
+	})
+}
+
+// GetLastStage returns the instructions of the last stage of the dockerfile,
+// like the layers of an image built in multiple stages.
+func GetLastStage(dockerfile string) string {
+	stage := ""
+	for _, line := range strings.SplitAfter(dockerfile, "\n") {
+		if strings.HasPrefix(line, "FROM ") {
+			stage = ""
+		}
+		stage += line
+	}
+	return stage
+}
+
+// GetSize returns the size of an image built from the given stage, which is the sum of the
+// sizes of its layers. A layer has the size stored in LayerSizes against a text that its instruction
+// contains, or else the length of its instruction.
+func (engine *Engine) GetSize(stage string) int64 {
+	var size int64
+	for _, line := range strings.SplitAfter(stage, "\n") {
+		layerSize := int64(len(line))
+		for text, textSize := range engine.LayerSizes {
+			if strings.Contains(line, text) {
+				layerSize = textSize
+				break
+			}
+		}
+		size += layerSize
+	}
+	return size
+}
+
+// ImageKey returns the key of the referenced image,
+// i.e the `repository:tag` reference without the registry host.
+func ImageKey(ref string) string {
+	reference := registry.ParseReference(ref)
+	return strings.TrimPrefix(reference.Repository, "library/") + ":" + reference.Tag
+}
+
+// readBuildContext reads the contents of the named dockerfile from the build
+// context tar, along with the names of all the files of the build context.
+func readBuildContext(buildContext io.Reader, dockerfile string) (string, []string, error) {
+	var contents string
+	var names []string
+	found := false
+	reader := tar.NewReader(buildContext)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error in reading build context")
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		names = append(names, name)
+		if name == dockerfile {
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return "", nil, errors.Wrap(err, "error in reading dockerfile from build context")
+			}
+			contents, found = string(data), true
+		}
+	}
+	if !found {
+		return "", nil, errors.Errorf("dockerfile %s not found in build context", dockerfile)
+	}
+	return contents, names, nil
+}
+
+// newMessageStream encodes the given messages as a stream of JSON messages.
+func newMessageStream(messages ...interface{}) (io.ReadCloser, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.NopCloser(buf), nil
+}
+
+// newErrorStream returns a stream of JSON messages reporting the given daemon side error.
+func newErrorStream(message string) (io.ReadCloser, error) {
+	return newMessageStream(
+		map[string]string{"status": "Preparing"},
+		map[string]interface{}{"error": message, "errorDetail": map[string]string{"message": message}})
+}
@@ -3,27 +3,36 @@
 package builder
 
 import (
-	"assignment-exec/image-builder/constants"
 	"assignment-exec/image-builder/environment"
-	"github.com/jhoonb/archivex"
+	"assignment-exec/image-builder/registry"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
-	"log"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-// dockerAuthData struct type holds username
-// and password for docker hub authentication.
+// dockerAuthData struct type holds username and password
+// for authentication with the registry at the server address.
 type dockerAuthData struct {
-	Username string
-	Password string
+	Username      string
+	Password      string
+	ServerAddress string
 }
 
-// imageBuildConfig struct type holds docker authentication data,
-// image tag, dockerfile location to be created, publishImage image flag.
-// All required to build assignment environment image.
+// imageBuildConfig struct type holds docker authentication data, registry,
+// image tag and labels, dockerfile location to be created, publishImage image flag.
+// All required to build assignment environment image. The image tag is derived
+// from the language tag, which is kept so that the image tag can be derived again.
 type imageBuildConfig struct {
 	authData      *dockerAuthData
+	registry      string
+	languageTag   string
 	imageTag      string
+	imageLabels   map[string]string
 	dockerfileLoc string
 	publishImage  bool
 }
@@ -74,6 +83,15 @@ func withDockerAuthData(authData *dockerAuthData) imageBuildConfigOption {
 	}
 }
 
+// withRegistry returns an imageBuildConfigOption for initializing the registry
+// to which the image is published.
+func withRegistry(registryHost string) imageBuildConfigOption {
+	return func(imgBuildCfg *imageBuildConfig) error {
+		imgBuildCfg.registry = registry.NormalizeRegistry(registryHost)
+		return nil
+	}
+}
+
 // withImageTag returns an imageBuildConfigOption for initializing image tag.
 func withImageTag(tag string) imageBuildConfigOption {
 	return func(imgBuildCfg *imageBuildConfig) error {
@@ -81,6 +99,7 @@ func withImageTag(tag string) imageBuildConfigOption {
 		if tag == "" {
 			return errors.New("image tag is empty")
 		}
+		imgBuildCfg.languageTag = tag
 		imgBuildCfg.imageTag = tag
 		return nil
 	}
@@ -94,73 +113,98 @@ func withPublishImageFlag(publishImage bool) imageBuildConfigOption {
 	}
 }
 
-// getAuthData reads the docker authentication data, i.e username
-// and password from environment variables.
-func getAuthData() (*dockerAuthData, error) {
-	username, hasFound := os.LookupEnv(environment.DockerAuthUsername)
-	if !hasFound {
-		return nil, errors.New("environment variable for username not set")
-	}
-	password, hasFound := os.LookupEnv(environment.DockerAuthPassword)
-	if !hasFound {
-		return nil, errors.New("environment variable for password not set")
-	}
+// getImageReference returns the fully qualified reference of
+// the image on the registry.
+func (imgBuildCfg imageBuildConfig) getImageReference() string {
+	return registry.NewReference(imgBuildCfg.registry, imgBuildCfg.imageTag, "").String()
+}
 
-	c := &dockerAuthData{Username: username, Password: password}
-	return c, nil
+// getLanguageImageReference returns the fully qualified reference of
+// the language image on the registry, i.e the image tagged with the language tag.
+func (imgBuildCfg imageBuildConfig) getLanguageImageReference() string {
+	return registry.NewReference(imgBuildCfg.registry, imgBuildCfg.languageTag, "").String()
 }
 
-// getDockerBuildContextTar creates a tar file for docker build context.
-// The tar holds Dockerfile and installation scripts that are required for
-// building the assignment environment image.
-func (imgBuildCfg imageBuildConfig) getDockerBuildContextTar() (*os.File, error) {
+// getAuthData reads the authentication data, i.e username and password for the given registry.
+// The credentials are read from environment variables if set, otherwise from the auths stored
+// by `docker login` in the docker configuration file.
+func getAuthData(registryHost string) (*dockerAuthData, error) {
+	registryHost = registry.NormalizeRegistry(registryHost)
 
-	// Gets the reader for the Dockerfile.
-	dockerFileReader, err := os.Open(imgBuildCfg.dockerfileLoc)
-	if err != nil {
-		return nil, errors.Wrap(err, "error in opening dockerfile for build context")
+	username, usernameFound := os.LookupEnv(environment.DockerAuthUsername)
+	password, passwordFound := os.LookupEnv(environment.DockerAuthPassword)
+	if usernameFound && passwordFound {
+		return &dockerAuthData{Username: username, Password: password, ServerAddress: registryHost}, nil
 	}
-	fileInfo, err := os.Stat(imgBuildCfg.dockerfileLoc)
+
+	authData, err := getDockerConfigAuthData(registryHost)
 	if err != nil {
-		return nil, errors.Wrap(err, "error in verifying dockerfile path")
+		return nil, err
 	}
+	if authData == nil {
+		return nil, errors.Errorf("environment variables for username and password not set "+
+			"and no credentials stored for registry %s", registryHost)
+	}
+	return authData, nil
+}
 
-	// Creates a new tar file named as `buildContext.tar`, add the installation scripts stored in
-	// `scripts` directory and add the Dockerfile.
-	buildContextTar := new(archivex.TarFile)
-	err = buildContextTar.Create(constants.BuildContextTar)
-	if err != nil {
-		return nil, errors.Wrap(err, "error in creating build context tar")
+// getDockerConfigAuthData reads the credentials for the given registry from the auths
+// stored in the docker configuration file. It returns nil if no credentials are stored.
+func getDockerConfigAuthData(registryHost string) (*dockerAuthData, error) {
+	configDir, found := os.LookupEnv(environment.DockerConfigDir)
+	if !found {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
 	}
-	err = buildContextTar.AddAll(constants.InstallationScriptsDir, true)
 	if err != nil {
-		return nil, errors.Wrap(err, "error in adding installation script to build context tar")
+		return nil, errors.Wrap(err, "error in reading docker configuration file")
 	}
 
-	err = buildContextTar.Add(imgBuildCfg.dockerfileLoc, dockerFileReader, fileInfo)
-	if err != nil {
-		return nil, errors.Wrap(err, "error in adding dockerfile to build context tar")
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return nil, errors.Wrap(err, "error in decoding docker configuration file")
 	}
 
-	defer func() {
-		err = buildContextTar.Close()
+	for server, auth := range dockerConfig.Auths {
+		// Docker hub credentials are stored against `https://index.docker.io/v1/`.
+		if registry.NormalizeRegistry(strings.TrimSuffix(server, "/v1/")) != registryHost || auth.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
 		if err != nil {
-			log.Println(err)
-			return
+			return nil, errors.Wrapf(err, "error in decoding credentials for registry %s", registryHost)
 		}
-	}()
-
-	// Reads the build context tar.
-	dockerBuildContext, err := os.Open(constants.BuildContextTar)
-	if err != nil {
-		return nil, errors.Wrap(err, "error in reading build context tar")
+		credentials := strings.SplitN(string(decoded), ":", 2)
+		if len(credentials) != 2 {
+			return nil, errors.Errorf("invalid credentials stored for registry %s", registryHost)
+		}
+		return &dockerAuthData{Username: credentials[0], Password: credentials[1], ServerAddress: registryHost}, nil
 	}
+	return nil, nil
+}
 
-	// Removes tha tar file as it is no longer needed.
-	err = os.Remove(constants.BuildContextTar)
+// encode returns the authentication data encoded as the value of
+// the registry authentication header expected by the container engine.
+func (authData *dockerAuthData) encode() (string, error) {
+	authJson, err := json.Marshal(types.AuthConfig{
+		Username:      authData.Username,
+		Password:      authData.Password,
+		ServerAddress: authData.ServerAddress,
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "error in removing the build context tar file")
+		return "", errors.Wrap(err, "error in encoding authConfig")
 	}
-
-	return dockerBuildContext, nil
+	return base64.URLEncoding.EncodeToString(authJson), nil
 }
@@ -0,0 +1,86 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/registry"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// inspectCommand struct type holds assignmentEnvironmentImageBuilder instance
+// which is required to inspect the assignment environment image, and the writer
+// to report the details to.
+type inspectCommand struct {
+	asgmtEnv *assignmentEnvironmentImageBuilder
+	writer   io.Writer
+}
+
+// execute reports the resolved image reference, the labels of the image and its
+// local image ID and registry digest, if the image is present locally or in the registry.
+func (cmd *inspectCommand) execute(ctx context.Context) error {
+	asgmtEnv := cmd.asgmtEnv
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	labels := asgmtEnv.ImgBuildConfig.imageLabels
+
+	writer := tabwriter.NewWriter(cmd.writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "Image:\t%s\n", imageRef)
+	fmt.Fprintf(writer, "Built from:\t%s\n", asgmtEnv.getBuildSource())
+
+	localImage, err := asgmtEnv.engine.InspectImage(ctx, imageRef)
+	if err != nil {
+		fmt.Fprintf(writer, "Local image:\tnot present\n")
+	} else {
+		fmt.Fprintf(writer, "Local image:\t%s\n", localImage.ID)
+		if len(localImage.Labels) > 0 {
+			labels = localImage.Labels
+		}
+	}
+
+	digest, err := asgmtEnv.registryClient.Resolve(ctx, registry.ParseReference(imageRef))
+	switch {
+	case registry.IsNotFound(err):
+		fmt.Fprintf(writer, "Registry digest:\tnot published\n")
+	case err != nil:
+		fmt.Fprintf(writer, "Registry digest:\tunknown (%v)\n", err)
+	default:
+		fmt.Fprintf(writer, "Registry digest:\t%s\n", digest)
+	}
+
+	fmt.Fprintf(writer, "Labels:\t\n")
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// The labels are aligned separately from the details above.
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	writer = tabwriter.NewWriter(cmd.writer, 0, 4, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(writer, "  %s\t%s\n", key, labels[key])
+	}
+	return writer.Flush()
+}
+
+// undo is a No operation function as inspecting has no side effects.
+func (cmd *inspectCommand) undo() error {
+	// No operation.
+	return nil
+}
+
+// plan reports the image that would be inspected.
+func (cmd *inspectCommand) plan(ctx context.Context, plan *Plan) error {
+	plan.addAction("inspect", "show details of image %s", cmd.asgmtEnv.ImgBuildConfig.getImageReference())
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *inspectCommand) phase() string {
+	return "inspect"
+}
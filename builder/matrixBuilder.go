@@ -0,0 +1,244 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/history"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultVariantName is the name of the single variant of a configuration without a matrix.
+const defaultVariantName = "default"
+
+// MatrixVariant struct type holds the name of a variant expanded from the
+// matrix of the configuration and the assignment environment of the variant.
+type MatrixVariant struct {
+	Name     string
+	asgmtEnv *assignmentEnvironmentImageBuilder
+}
+
+// Commands returns a BuildManagerOption for initializing the commands
+// to verify, build and publish the image of the variant. The reference of the
+// published image is reported by the matrix summary instead of being written.
+func (variant *MatrixVariant) Commands() BuildManagerOption {
+	return WithCommands(variant.asgmtEnv, ioutil.Discard)
+}
+
+// GetMatrixConfigurations reads the config file, expands its matrix into the configuration
+// variants and sets the assignmentEnvironmentImageBuilder instance of every variant in the same
+// way as GetConfigurations. The dockerfile of each variant is written to the dockerfile location
+// suffixed with the name of the variant. Variants that expand into the same configuration are refused.
+// The variants are not pinned by the lock file of the config file, which is reported if present.
+func GetMatrixConfigurations(publishImage bool, registryHost string, configFilepath string, dockerfileLoc string,
+	options ...assignmentEnvironmentImageBuilderOption) ([]*MatrixVariant, error) {
+	configVariants, err := configurations.GetAssignmentEnvConfigVariants(configFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []*MatrixVariant
+	variantsByDigest := make(map[string]string)
+	for _, configVariant := range configVariants {
+		name := configVariant.Name
+		if name == "" {
+			name = defaultVariantName
+		}
+		digest, err := configVariant.Config.GetDigest()
+		if err != nil {
+			return nil, err
+		}
+		key := digest + " " + configVariant.Config.Registry
+		if existing, found := variantsByDigest[key]; found {
+			return nil, errors.Errorf("matrix variants %s and %s expand into the same configuration", existing, name)
+		}
+		variantsByDigest[key] = name
+
+		asgmtEnv, err := NewConfigurations(publishImage, registryHost, configVariant.Config,
+			dockerfileLoc+"."+name, options...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in matrix variant %s", name)
+		}
+		variants = append(variants, &MatrixVariant{Name: name, asgmtEnv: asgmtEnv})
+	}
+	// The variants differ in their languages, so they cannot be pinned by the single lock file of the config file.
+	if err := WarnIgnoredEnvLock(variants[0].asgmtEnv.renderer, configFilepath, "matrix builds"); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// MatrixResult struct type holds the outcome of building the image of a matrix variant,
+// i.e the image reference, ID and digest, the duration and the error that failed it, if any.
+type MatrixResult struct {
+	Name        string
+	Image       string
+	ImageID     string
+	ImageDigest string
+	Duration    time.Duration
+	Err         error
+}
+
+// MatrixBuilder struct type holds the variants expanded from the matrix of a configuration,
+// the maximum number of variants built concurrently and the store recording every build, if any.
+type MatrixBuilder struct {
+	variants    []*MatrixVariant
+	concurrency int
+	history     *history.Store
+}
+
+// MatrixBuilderOption represents options that can be used to help initialize
+// an instance of MatrixBuilder.
+// Each option is a closure that is responsible for initializing one or more members
+// while instantiating MatrixBuilder.
+type MatrixBuilderOption func(*MatrixBuilder) error
+
+// NewMatrixBuilder constructs an instance of MatrixBuilder
+// by applying each of the provided options.
+// The construction of the object fails upon the failure of at least one of the given options.
+func NewMatrixBuilder(options ...MatrixBuilderOption) (*MatrixBuilder, error) {
+	matrix := &MatrixBuilder{concurrency: 1}
+	for _, opt := range options {
+		if err := opt(matrix); err != nil {
+			return nil, errors.Wrap(err, "failed to create matrix builder instance")
+		}
+	}
+	return matrix, nil
+}
+
+// WithMatrixVariants returns a MatrixBuilderOption for initializing the variants to build.
+func WithMatrixVariants(variants []*MatrixVariant) MatrixBuilderOption {
+	return func(matrix *MatrixBuilder) error {
+		if len(variants) == 0 {
+			return errors.New("matrix variants not provided")
+		}
+		matrix.variants = variants
+		return nil
+	}
+}
+
+// WithConcurrencyLimit returns a MatrixBuilderOption for initializing
+// the maximum number of variants that are built concurrently.
+func WithConcurrencyLimit(concurrency int) MatrixBuilderOption {
+	return func(matrix *MatrixBuilder) error {
+		if concurrency <= 0 {
+			return errors.New("concurrency limit must be positive")
+		}
+		matrix.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithMatrixHistory returns a MatrixBuilderOption for initializing the store
+// in which the build of every variant is recorded.
+func WithMatrixHistory(store *history.Store) MatrixBuilderOption {
+	return func(matrix *MatrixBuilder) error {
+		if store == nil {
+			return errors.New("history store not provided")
+		}
+		matrix.history = store
+		return nil
+	}
+}
+
+// Execute builds the variants through their own BuildManager, running at most the concurrency
+// limit of them at once. The progress of every variant is rendered with the name of the variant
+// prefixed to its phases. A failed variant is undone without affecting the other variants.
+// It returns the results in the order of the variants.
+func (matrix *MatrixBuilder) Execute(ctx context.Context) []MatrixResult {
+	results := make([]MatrixResult, len(matrix.variants))
+	slots := make(chan struct{}, matrix.concurrency)
+	renderMutex := &sync.Mutex{}
+	waitGroup := sync.WaitGroup{}
+
+	for i, variant := range matrix.variants {
+		variant.asgmtEnv.renderer = &variantRenderer{
+			name:     variant.Name,
+			renderer: variant.asgmtEnv.renderer,
+			mutex:    renderMutex,
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = MatrixResult{Name: variant.Name, Err: errors.Wrap(ctx.Err(), "build of variant not started")}
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(i int, variant *MatrixVariant) {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+			results[i] = matrix.executeVariant(ctx, variant)
+		}(i, variant)
+	}
+	waitGroup.Wait()
+	return results
+}
+
+// executeVariant builds the variant through its own BuildManager and returns its result.
+func (matrix *MatrixBuilder) executeVariant(ctx context.Context, variant *MatrixVariant) MatrixResult {
+	start := time.Now()
+	options := []BuildManagerOption{variant.Commands()}
+	if matrix.history != nil {
+		options = append(options, WithHistory(matrix.history))
+	}
+	buildManager, err := NewBuildManager(options...)
+	if err == nil {
+		err = buildManager.ExecuteCommands(ctx)
+	}
+	return MatrixResult{
+		Name:        variant.Name,
+		Image:       variant.asgmtEnv.GetImageReference(),
+		ImageID:     variant.asgmtEnv.ImageID,
+		ImageDigest: variant.asgmtEnv.ImageDigest,
+		Duration:    time.Since(start),
+		Err:         err,
+	}
+}
+
+// WriteMatrixSummary writes the results of the variants as a table of their image tags,
+// digests and failures. The ID of the local image is shown for an image that is not published.
+func WriteMatrixSummary(writer io.Writer, results []MatrixResult) error {
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "VARIANT\tIMAGE\tDIGEST\tDURATION\tRESULT\n")
+	for _, result := range results {
+		digest := result.ImageDigest
+		if digest == "" {
+			digest = result.ImageID
+		}
+		if digest == "" {
+			digest = "-"
+		}
+		outcome := "succeeded"
+		if result.Err != nil {
+			outcome = "failed: " + strings.Replace(result.Err.Error(), "\n", " ", -1)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", result.Name, result.Image, digest,
+			result.Duration.Round(time.Millisecond), outcome)
+	}
+	return table.Flush()
+}
+
+// variantRenderer struct type holds the name of a matrix variant and the renderer of its
+// progress, along with the mutex serializing the rendering of the concurrent variants.
+type variantRenderer struct {
+	name     string
+	renderer ProgressRenderer
+	mutex    *sync.Mutex
+}
+
+// Render renders the event with the name of the variant prefixed to its phase.
+func (renderer *variantRenderer) Render(event ProgressEvent) error {
+	renderer.mutex.Lock()
+	defer renderer.mutex.Unlock()
+	event.Phase = renderer.name + "/" + event.Phase
+	return renderer.renderer.Render(event)
+}
@@ -0,0 +1,65 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/builder/fake"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMatrixBuilder tests that the variants of the matrix are built concurrently, that a failed
+// variant does not abort the others and that the lock file of the config file is reported as ignored.
+func TestMatrixBuilder(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	config, err := ioutil.ReadFile(env.configFile)
+	assert.NoError(t, err)
+	matrix := "matrix:\n  language:\n    - name: gcc7\n    - name: python37\n" +
+		"      dependencies:\n        lang: python\n        langVersion: 3.7\n"
+	assert.NoError(t, ioutil.WriteFile(env.configFile, append(config, []byte(matrix)...), 0644))
+	env.engine.ContainerResults["hello.c"] = containers.ContainerResult{ExitCode: 1}
+	lockFilepath := filepath.Join(filepath.Dir(env.configFile), "assignment-env.lock")
+	assert.NoError(t, ioutil.WriteFile(lockFilepath, []byte("baseImage: {}\n"), 0644))
+
+	output := &bytes.Buffer{}
+	variants, err := GetMatrixConfigurations(true, "", env.configFile, env.dockerfileLoc,
+		WithContainerEngine(env.engine), WithProgressRenderer(&plainRenderer{writer: output}))
+	assert.NoError(t, err)
+	assert.Len(t, variants, 2)
+	assert.Contains(t, output.String(), "Warning: lock file "+lockFilepath+" is ignored by matrix builds")
+
+	matrixBuilder, err := NewMatrixBuilder(WithMatrixVariants(variants), WithConcurrencyLimit(2))
+	assert.NoError(t, err)
+	results := matrixBuilder.Execute(context.Background())
+
+	assert.Equal(t, "gcc7", results[0].Name)
+	assert.EqualError(t, results[0].Err, "smoke check compile and run hello.c failed with exit code 1")
+	assert.Equal(t, "python37", results[1].Name)
+	assert.NoError(t, results[1].Err)
+	assert.Contains(t, results[1].Image, "/assignmentexec/python3.7-")
+	assert.Equal(t, env.engine.RemoteImages[fake.ImageKey(results[1].Image)].ID, results[1].ImageDigest)
+	assert.NotContains(t, env.engine.RemoteImages, fake.ImageKey(results[0].Image))
+	assert.Contains(t, output.String(), "[python37/build] Successfully built")
+
+	summary := &bytes.Buffer{}
+	assert.NoError(t, WriteMatrixSummary(summary, results))
+	lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "failed: smoke check")
+	assert.Contains(t, lines[2], results[1].ImageDigest+"  ")
+	assert.Contains(t, lines[2], "succeeded")
+
+	_, err = os.Stat(env.dockerfileLoc + ".python37")
+	assert.NoError(t, err)
+	_, err = NewMatrixBuilder(WithConcurrencyLimit(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Plan struct type holds the intended effect of the commands of a BuildManager,
+// as reported by each command without executing it.
+type Plan struct {
+	ImageReference      string          `json:"imageReference,omitempty"`
+	BuildSource         string          `json:"buildSource,omitempty"`
+	LanguageImageReused bool            `json:"languageImageReused"`
+	ImageExists         bool            `json:"imageExists"`
+	DockerfileLocation  string          `json:"dockerfileLocation,omitempty"`
+	Dockerfile          string          `json:"dockerfile,omitempty"`
+	BuildContext        []string        `json:"buildContext,omitempty"`
+	Push                bool            `json:"push"`
+	Actions             []PlannedAction `json:"actions"`
+}
+
+// PlannedAction struct type holds the phase of a command and the
+// description of the effect that executing it would have.
+type PlannedAction struct {
+	Phase       string `json:"phase"`
+	Description string `json:"description"`
+}
+
+// addAction appends the intended effect of a phase to the plan.
+func (plan *Plan) addAction(phase string, format string, args ...interface{}) {
+	plan.Actions = append(plan.Actions, PlannedAction{Phase: phase, Description: fmt.Sprintf(format, args...)})
+}
+
+// WriteText writes the plan in a human readable form.
+func (plan *Plan) WriteText(writer io.Writer) error {
+	buf := &strings.Builder{}
+	if plan.ImageReference != "" {
+		fmt.Fprintf(buf, "Image: %s\n", plan.ImageReference)
+	}
+	if plan.BuildSource != "" {
+		fmt.Fprintf(buf, "Built from: %s\n", plan.BuildSource)
+	}
+	fmt.Fprintf(buf, "\nActions:\n")
+	for i, action := range plan.Actions {
+		fmt.Fprintf(buf, "  %d. [%s] %s\n", i+1, action.Phase, action.Description)
+	}
+	if len(plan.BuildContext) > 0 {
+		fmt.Fprintf(buf, "\nBuild context:\n")
+		for _, entry := range plan.BuildContext {
+			fmt.Fprintf(buf, "  %s\n", entry)
+		}
+	}
+	if plan.Dockerfile != "" {
+		fmt.Fprintf(buf, "\nDockerfile (%s):\n", plan.DockerfileLocation)
+		for _, line := range strings.Split(strings.TrimRight(plan.Dockerfile, "\n"), "\n") {
+			fmt.Fprintf(buf, "  %s\n", line)
+		}
+	}
+	_, err := io.WriteString(writer, buf.String())
+	return err
+}
+
+// WriteJSON writes the plan as indented JSON.
+func (plan *Plan) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
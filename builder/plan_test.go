@@ -0,0 +1,80 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/builder/fake"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestPlanCommands tests that planning reports the intended effect
+// of the full pipeline without building or publishing the image.
+func TestPlanCommands(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	plan, err := buildManager.PlanCommands(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, asgmtEnv.ImgBuildConfig.getImageReference(), plan.ImageReference)
+	assert.False(t, plan.LanguageImageReused)
+	assert.True(t, plan.Push)
+	assert.Equal(t, asgmtEnv.DockerfileInstructions.String(), plan.Dockerfile)
+	assert.Equal(t, []string{"Dockerfile", "scripts/gcc_7.sh"}, plan.BuildContext)
+	assert.Len(t, plan.Actions, 7)
+
+	// Nothing is written, built or pushed.
+	_, err = os.Stat(env.dockerfileLoc)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(asgmtEnv.envLockFilepath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, env.engine.LocalImages)
+	assert.Len(t, env.engine.RemoteImages, 1)
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, plan.WriteJSON(output))
+	decoded := &Plan{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), decoded))
+	assert.Equal(t, plan, decoded)
+
+	// Executing the planned commands verifies the configuration again, which yields the planned image.
+	assert.NoError(t, buildManager.ExecuteCommands(context.Background()))
+	assert.Equal(t, plan.ImageReference, asgmtEnv.ImgBuildConfig.getImageReference())
+	assert.Equal(t, plan.Dockerfile, asgmtEnv.DockerfileInstructions.String())
+	assert.Contains(t, env.engine.LocalImages, fake.ImageKey(plan.ImageReference))
+}
+
+// TestPlanCommandsWithExistingLanguageImage tests that planning reports
+// the reuse of the language image present in the registry.
+func TestPlanCommandsWithExistingLanguageImage(t *testing.T) {
+	env, cleanup := setupFakeEnvironment(t)
+	defer cleanup()
+	env.engine.RemoteImages["assignmentexec/gcc7:latest"] = &containers.ImageInfo{ID: "sha256:gcc7"}
+
+	asgmtEnv, err := GetConfigurations(true, "", env.configFile, env.dockerfileLoc, WithContainerEngine(env.engine))
+	assert.NoError(t, err)
+	buildManager, err := NewBuildManager(WithCommands(asgmtEnv, ioutil.Discard))
+	assert.NoError(t, err)
+	plan, err := buildManager.PlanCommands(context.Background())
+	assert.NoError(t, err)
+
+	assert.True(t, plan.LanguageImageReused)
+	assert.True(t, plan.ImageExists)
+	assert.False(t, plan.Push)
+	assert.Empty(t, plan.Dockerfile)
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, plan.WriteText(output))
+	assert.Contains(t, output.String(), "[build] pull existing language image "+env.registry+"/assignmentexec/gcc7:latest")
+}
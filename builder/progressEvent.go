@@ -0,0 +1,152 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProgressEventType represents the kind of a progress event.
+type ProgressEventType string
+
+const (
+	// StepEvent is emitted when the build starts executing a dockerfile instruction.
+	StepEvent ProgressEventType = "step"
+	// LayerProgressEvent is emitted for the progress of a layer being pulled, pushed or extracted.
+	LayerProgressEvent ProgressEventType = "layer"
+	// StatusEvent is emitted for any other output of the operation.
+	StatusEvent ProgressEventType = "status"
+	// ErrorEvent is emitted when the operation fails on the daemon side.
+	ErrorEvent ProgressEventType = "error"
+)
+
+// ProgressEvent struct type holds a typed event decoded from the progress stream
+// of a build, push or pull operation.
+type ProgressEvent struct {
+	Type       ProgressEventType `json:"type"`
+	Phase      string            `json:"phase"`
+	Message    string            `json:"message,omitempty"`
+	Step       int               `json:"step,omitempty"`
+	TotalSteps int               `json:"totalSteps,omitempty"`
+	LayerID    string            `json:"layerId,omitempty"`
+	Current    int64             `json:"current,omitempty"`
+	Total      int64             `json:"total,omitempty"`
+}
+
+// progressResult struct type holds the details reported in the progress stream
+// once the operation completes, i.e the built image ID or the pushed manifest digest.
+type progressResult struct {
+	ImageID string
+	Digest  string
+}
+
+// jsonMessage struct type holds a single message of the progress stream
+// as sent by the docker daemon.
+type jsonMessage struct {
+	Stream         string `json:"stream"`
+	Status         string `json:"status"`
+	ID             string `json:"id"`
+	Progress       string `json:"progress"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	Aux *struct {
+		ID     string `json:"ID"`
+		Digest string `json:"Digest"`
+	} `json:"aux"`
+}
+
+// stepPattern matches the stream message for the start of a build step, e.g `Step 2/5 : RUN ...`.
+var stepPattern = regexp.MustCompile(`^Step (\d+)/(\d+) : (.*)$`)
+
+// digestPattern matches the digest in the status message that completes a push or a pull.
+var digestPattern = regexp.MustCompile(`(?:digest|Digest): (sha256:[0-9a-f]+)`)
+
+// decodeProgress decodes the progress stream of the given phase into typed events,
+// which are passed on to the renderer. It returns the details reported on completion,
+// or an error if the stream reports that the operation failed.
+func decodeProgress(phase string, stream io.Reader, renderer ProgressRenderer) (*progressResult, error) {
+	result := &progressResult{}
+	decoder := json.NewDecoder(stream)
+	for {
+		var message jsonMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error in decoding %s progress", phase)
+		}
+
+		event, err := newProgressEvent(phase, message, result)
+		if event != nil {
+			if renderErr := renderer.Render(*event); renderErr != nil {
+				return nil, errors.Wrapf(renderErr, "error in rendering %s progress", phase)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newProgressEvent converts a message of the progress stream into a progress event and
+// updates the result with any reported details. It returns an error for an error message.
+// No event is returned for messages carrying no output.
+func newProgressEvent(phase string, message jsonMessage, result *progressResult) (*ProgressEvent, error) {
+	if message.Aux != nil {
+		if message.Aux.ID != "" {
+			result.ImageID = message.Aux.ID
+		}
+		if message.Aux.Digest != "" {
+			result.Digest = message.Aux.Digest
+		}
+	}
+
+	if message.Error != "" || message.ErrorDetail != nil {
+		errorMessage := message.Error
+		if message.ErrorDetail != nil && message.ErrorDetail.Message != "" {
+			errorMessage = message.ErrorDetail.Message
+		}
+		return &ProgressEvent{Type: ErrorEvent, Phase: phase, Message: errorMessage},
+			errors.Errorf("%s failed: %s", phase, errorMessage)
+	}
+
+	if message.Stream != "" {
+		text := strings.TrimRight(message.Stream, "\n")
+		if text == "" {
+			return nil, nil
+		}
+		if match := stepPattern.FindStringSubmatch(text); match != nil {
+			step, _ := strconv.Atoi(match[1])
+			totalSteps, _ := strconv.Atoi(match[2])
+			return &ProgressEvent{Type: StepEvent, Phase: phase, Message: match[3],
+				Step: step, TotalSteps: totalSteps}, nil
+		}
+		if strings.HasPrefix(text, "Successfully built ") {
+			result.ImageID = strings.TrimPrefix(text, "Successfully built ")
+		}
+		return &ProgressEvent{Type: StatusEvent, Phase: phase, Message: text}, nil
+	}
+
+	if message.Status == "" {
+		return nil, nil
+	}
+	if match := digestPattern.FindStringSubmatch(message.Status); match != nil && result.Digest == "" {
+		result.Digest = match[1]
+	}
+	if message.ID != "" {
+		return &ProgressEvent{Type: LayerProgressEvent, Phase: phase, Message: message.Status,
+			LayerID: message.ID, Current: message.ProgressDetail.Current, Total: message.ProgressDetail.Total}, nil
+	}
+	return &ProgressEvent{Type: StatusEvent, Phase: phase, Message: message.Status}, nil
+}
@@ -0,0 +1,63 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var buildProgressStream = `{"stream":"Step 1/2 : FROM assignmentexec/code-runner:1.0\n"}
+{"stream":" ---> 2f6a1c1ec0e4\n"}
+{"stream":"Step 2/2 : RUN ./scripts/gcc_7.sh\n"}
+{"status":"Downloading","progressDetail":{"current":512,"total":1024},"id":"a1b2c3"}
+{"errorDetail":{"code":100,"message":"The command '/bin/sh -c ./scripts/gcc_7.sh' returned a non-zero code: 100"},"error":"The command '/bin/sh -c ./scripts/gcc_7.sh' returned a non-zero code: 100"}
+`
+
+// TestDecodeProgress tests the decoding of the build progress stream
+// into typed events and the detection of the daemon side error.
+func TestDecodeProgress(t *testing.T) {
+	output := &bytes.Buffer{}
+	renderer, err := NewProgressRenderer(JSONProgress, output)
+	assert.NoError(t, err)
+
+	_, err = decodeProgress("build", strings.NewReader(buildProgressStream), renderer)
+	assert.EqualError(t, err, "build failed: The command '/bin/sh -c ./scripts/gcc_7.sh' returned a non-zero code: 100")
+
+	var events []ProgressEvent
+	decoder := json.NewDecoder(output)
+	for decoder.More() {
+		var event ProgressEvent
+		assert.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	assert.Equal(t, []ProgressEvent{
+		{Type: StepEvent, Phase: "build", Message: "FROM assignmentexec/code-runner:1.0", Step: 1, TotalSteps: 2},
+		{Type: StatusEvent, Phase: "build", Message: " ---> 2f6a1c1ec0e4"},
+		{Type: StepEvent, Phase: "build", Message: "RUN ./scripts/gcc_7.sh", Step: 2, TotalSteps: 2},
+		{Type: LayerProgressEvent, Phase: "build", Message: "Downloading", LayerID: "a1b2c3", Current: 512, Total: 1024},
+		{Type: ErrorEvent, Phase: "build",
+			Message: "The command '/bin/sh -c ./scripts/gcc_7.sh' returned a non-zero code: 100"},
+	}, events)
+}
+
+// TestDecodePushProgress tests that the digest reported on
+// completion of a push is returned.
+func TestDecodePushProgress(t *testing.T) {
+	stream := `{"status":"The push refers to repository [docker.io/user/gcc7]"}
+{"status":"Pushed","progressDetail":{},"id":"a1b2c3"}
+{"status":"latest: digest: sha256:0123abcd size: 528"}
+`
+	output := &bytes.Buffer{}
+	renderer, err := NewProgressRenderer(PlainProgress, output)
+	assert.NoError(t, err)
+
+	result, err := decodeProgress("push", strings.NewReader(stream), renderer)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:0123abcd", result.Digest)
+	assert.Equal(t, "[push] The push refers to repository [docker.io/user/gcc7]\n[push] a1b2c3: Pushed\n"+
+		"[push] latest: digest: sha256:0123abcd size: 528\n", output.String())
+}
@@ -0,0 +1,159 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Progress output formats supported by NewProgressRenderer.
+const (
+	PlainProgress = "plain"
+	TTYProgress   = "tty"
+	JSONProgress  = "json"
+	AutoProgress  = "auto"
+)
+
+// progressBarWidth is the number of characters used by a tty progress bar.
+const progressBarWidth = 40
+
+// ProgressRenderer interface type represents the display of
+// the progress events of build, push and pull operations.
+type ProgressRenderer interface {
+	Render(event ProgressEvent) error
+}
+
+// NewProgressRenderer creates a ProgressRenderer writing to the given writer in the given format.
+// The `auto` format renders progress bars if the writer is a terminal and plain text otherwise.
+func NewProgressRenderer(format string, writer io.Writer) (ProgressRenderer, error) {
+	switch format {
+	case PlainProgress:
+		return &plainRenderer{writer: writer}, nil
+	case TTYProgress:
+		return &ttyRenderer{writer: writer, layerLines: make(map[string]int)}, nil
+	case JSONProgress:
+		return &jsonRenderer{encoder: json.NewEncoder(writer)}, nil
+	case AutoProgress:
+		if isTerminal(writer) {
+			return NewProgressRenderer(TTYProgress, writer)
+		}
+		return NewProgressRenderer(PlainProgress, writer)
+	}
+	return nil, errors.Errorf("unsupported progress format %q", format)
+}
+
+// isTerminal checks whether the writer is a character device, i.e a terminal.
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// plainRenderer renders every progress event as a line of text.
+// Layer progress is only rendered when the status of the layer changes.
+type plainRenderer struct {
+	writer      io.Writer
+	layerStatus map[string]string
+}
+
+// Render writes the event as a line of text.
+func (renderer *plainRenderer) Render(event ProgressEvent) error {
+	var err error
+	switch event.Type {
+	case StepEvent:
+		_, err = fmt.Fprintf(renderer.writer, "[%s] Step %d/%d: %s\n", event.Phase, event.Step, event.TotalSteps, event.Message)
+	case LayerProgressEvent:
+		if renderer.layerStatus == nil {
+			renderer.layerStatus = make(map[string]string)
+		}
+		if renderer.layerStatus[event.LayerID] == event.Message {
+			return nil
+		}
+		renderer.layerStatus[event.LayerID] = event.Message
+		_, err = fmt.Fprintf(renderer.writer, "[%s] %s: %s\n", event.Phase, event.LayerID, event.Message)
+	case ErrorEvent:
+		_, err = fmt.Fprintf(renderer.writer, "[%s] ERROR: %s\n", event.Phase, event.Message)
+	default:
+		_, err = fmt.Fprintf(renderer.writer, "[%s] %s\n", event.Phase, event.Message)
+	}
+	return err
+}
+
+// ttyRenderer renders layer progress as progress bars that are updated in place,
+// one line per layer, and every other event as a line of text.
+type ttyRenderer struct {
+	writer     io.Writer
+	layerLines map[string]int
+	lines      int
+}
+
+// Render writes the event, moving the cursor to the line of the layer for layer progress.
+func (renderer *ttyRenderer) Render(event ProgressEvent) error {
+	if event.Type != LayerProgressEvent {
+		// The layer lines are not updated anymore once other output follows them.
+		renderer.layerLines = make(map[string]int)
+		renderer.lines = 0
+		return (&plainRenderer{writer: renderer.writer}).Render(event)
+	}
+
+	text := fmt.Sprintf("%s: %s %s", event.LayerID, event.Message, formatProgressBar(event.Current, event.Total))
+	line, found := renderer.layerLines[event.LayerID]
+	if !found {
+		renderer.layerLines[event.LayerID] = renderer.lines
+		renderer.lines++
+		_, err := fmt.Fprintf(renderer.writer, "%s\n", text)
+		return err
+	}
+
+	// Move up to the line of the layer, rewrite it and move back down.
+	offset := renderer.lines - line
+	_, err := fmt.Fprintf(renderer.writer, "\x1b[%dA\r\x1b[2K%s\x1b[%dB\r", offset, text, offset)
+	return err
+}
+
+// formatProgressBar returns a progress bar for the current and total sizes,
+// or an empty string if the total size is not known.
+func formatProgressBar(current int64, total int64) string {
+	if total <= 0 {
+		return ""
+	}
+	if current > total {
+		current = total
+	}
+	filled := int(int64(progressBarWidth) * current / total)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return fmt.Sprintf("[%s] %s/%s", bar, formatSize(current), formatSize(total))
+}
+
+// formatSize returns the size in bytes in a human readable form.
+func formatSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.4g%s", value, units[unit])
+}
+
+// jsonRenderer renders every progress event as a line of JSON.
+type jsonRenderer struct {
+	encoder *json.Encoder
+}
+
+// Render writes the event as a line of JSON.
+func (renderer *jsonRenderer) Render(event ProgressEvent) error {
+	return renderer.encoder.Encode(event)
+}
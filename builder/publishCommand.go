@@ -3,36 +3,75 @@
 package builder
 
 import (
-	"assignment-exec/image-builder/constants"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"io"
 )
 
 // publishCommand struct type holds assignmentEnvironmentImageBuilder instance
-// which is required to perform image publish operation.
+// which is required to perform image publish operation, the writer to which the
+// reference of the image is written, and whether the local image is to be kept
+// if the publish fails, i.e when it was not built by this run.
 type publishCommand struct {
-	asgmtEnv *assignmentEnvironmentImageBuilder
+	asgmtEnv  *assignmentEnvironmentImageBuilder
+	writer    io.Writer
+	keepImage bool
 }
 
-// execute invokes the publishImage function to push the image to docker hub.
-func (cmd *publishCommand) execute() error {
+// execute invokes the publishImage function to push the image to the registry.
+// The command for starting the image is reported as progress, while the reference
+// of the image, pinned by its digest once pushed, is written to the writer.
+func (cmd *publishCommand) execute(ctx context.Context) error {
 
-	if err := cmd.asgmtEnv.publishImage(); err != nil {
+	if err := cmd.asgmtEnv.runPhase(ctx, "publish", cmd.asgmtEnv.publishImage); err != nil {
 		return err
 	}
-	dockerRunCmd := fmt.Sprintf("%s %s %s", constants.DockerRunCommand,
-		cmd.asgmtEnv.ImgBuildConfig.imageTag, constants.PortCmdArg)
-	fmt.Printf("\nFollowing is the command for starting %s\n\n", cmd.asgmtEnv.ImgBuildConfig.imageTag)
-	fmt.Println(dockerRunCmd)
+	imageRef := cmd.asgmtEnv.ImgBuildConfig.getImageReference()
+	dockerRunCmd := cmd.asgmtEnv.AsgmtEnvConfig.CodeRunner.GetRunCommand(imageRef)
+	if err := cmd.asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "publish",
+		Message: fmt.Sprintf("Following is the command for starting %s: %s", imageRef, dockerRunCmd)}); err != nil {
+		return err
+	}
+
+	if cmd.asgmtEnv.ImageDigest != "" {
+		imageRef += "@" + cmd.asgmtEnv.ImageDigest
+	}
+	if _, err := fmt.Fprintln(cmd.writer, imageRef); err != nil {
+		return errors.Wrap(err, "error in writing image reference")
+	}
 	return nil
 }
 
 // undo invokes undoBuild function to remove the locally built image
 // if any error is encountered while publishing the image.
 func (cmd *publishCommand) undo() error {
+	if cmd.keepImage {
+		return nil
+	}
 	err := cmd.asgmtEnv.undoBuild()
 	if err != nil {
 		return errors.Wrap(err, "error in undo publish operation")
 	}
 	return nil
 }
+
+// plan reports whether the image would be pushed to the registry.
+func (cmd *publishCommand) plan(ctx context.Context, plan *Plan) error {
+	imageRef := cmd.asgmtEnv.ImgBuildConfig.getImageReference()
+	switch {
+	case cmd.asgmtEnv.ImageExists:
+		plan.addAction("publish", "skip push as %s is already in the registry", imageRef)
+	case !cmd.asgmtEnv.ImgBuildConfig.publishImage:
+		plan.addAction("publish", "skip push as publishing is not requested")
+	default:
+		plan.Push = true
+		plan.addAction("publish", "push image %s", imageRef)
+	}
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *publishCommand) phase() string {
+	return "publish"
+}
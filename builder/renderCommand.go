@@ -0,0 +1,46 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// renderCommand struct type holds assignmentEnvironmentImageBuilder instance
+// which holds the dockerfile instructions, and the writer to render them to.
+type renderCommand struct {
+	asgmtEnv *assignmentEnvironmentImageBuilder
+	writer   io.Writer
+}
+
+// execute writes the stored dockerfile instructions to the writer. If the image
+// already exists, then no instructions are written and a comment says so instead.
+func (cmd *renderCommand) execute(ctx context.Context) error {
+	if cmd.asgmtEnv.ImageExists {
+		_, err := fmt.Fprintf(cmd.writer, "# Image %s already exists, nothing to build.\n",
+			cmd.asgmtEnv.ImgBuildConfig.getImageReference())
+		return err
+	}
+	_, err := io.WriteString(cmd.writer, cmd.asgmtEnv.DockerfileInstructions.String())
+	return err
+}
+
+// undo is a No operation function as rendering has no side effects.
+func (cmd *renderCommand) undo() error {
+	// No operation.
+	return nil
+}
+
+// plan reports the dockerfile that would be rendered.
+func (cmd *renderCommand) plan(ctx context.Context, plan *Plan) error {
+	plan.Dockerfile = cmd.asgmtEnv.DockerfileInstructions.String()
+	plan.addAction("render", "print the Dockerfile")
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *renderCommand) phase() string {
+	return "render"
+}
@@ -0,0 +1,125 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/scripts"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// smokeCheck struct type holds the name of a check run against the built image
+// and the shell script performing it, which exits with a non zero code upon failure.
+type smokeCheck struct {
+	name   string
+	script string
+}
+
+// helloWorld is the output expected from the hello world programs of the smoke checks.
+const helloWorld = "hello world"
+
+// smokeCheckers holds the functions generating the smoke checks of a language by its name.
+// Each function is given the binaries provided by the installation script of the language,
+// if any, and the dependencies of the configuration.
+var smokeCheckers = map[string]func(provides []string, deps configurations.Dependencies) []smokeCheck{
+	"gcc": func(provides []string, _ configurations.Dependencies) []smokeCheck {
+		source := `#include <stdio.h>\nint main(void) { printf("` + helloWorld + `\\n"); return 0; }\n`
+		return []smokeCheck{compileAndRun("hello.c", source, getCompiler(provides, "gcc")+" -o /tmp/hello /tmp/hello.c", "/tmp/hello")}
+	},
+	"gpp": func(provides []string, _ configurations.Dependencies) []smokeCheck {
+		source := `#include <iostream>\nint main() { std::cout << "` + helloWorld + `" << std::endl; return 0; }\n`
+		return []smokeCheck{compileAndRun("hello.cpp", source, getCompiler(provides, "g++")+" -o /tmp/hello /tmp/hello.cpp", "/tmp/hello")}
+	},
+	"java": func(_ []string, _ configurations.Dependencies) []smokeCheck {
+		source := `public class Hello { public static void main(String[] args) { System.out.println("` + helloWorld + `"); } }\n`
+		return []smokeCheck{compileAndRun("Hello.java", source, "javac -d /tmp /tmp/Hello.java", "java -cp /tmp Hello")}
+	},
+	"python": func(_ []string, deps configurations.Dependencies) []smokeCheck {
+		checks := []smokeCheck{{name: "python hello world", script: fmt.Sprintf(`test "$(python -c 'print("%s")')" = '%s'`, helloWorld, helloWorld)}}
+		for _, name := range deps.GetLibraryNames() {
+			if deps.Libraries[name].Manager != "pip" {
+				continue
+			}
+			module := getPythonModule(name)
+			checks = append(checks, smokeCheck{name: "import " + module, script: "python -c 'import " + module + "'"})
+		}
+		return checks
+	},
+}
+
+// compileAndRun returns the smoke check that writes the source file of a hello world program,
+// compiles it with the given command and verifies the output of running it.
+func compileAndRun(file string, source string, compileCmd string, runCmd string) smokeCheck {
+	return smokeCheck{
+		name: "compile and run " + file,
+		script: fmt.Sprintf(`printf '%s' > /tmp/%s && %s && test "$(%s)" = '%s'`,
+			source, file, compileCmd, runCmd, helloWorld),
+	}
+}
+
+// getCompiler returns the first binary provided by the installation script,
+// e.g the versioned `gcc-7`, or the given default if the script provides none.
+func getCompiler(provides []string, defaultCompiler string) string {
+	if len(provides) > 0 {
+		return provides[0]
+	}
+	return defaultCompiler
+}
+
+// getPythonModule returns the name of the module imported for the given pip library,
+// i.e the library name without extras, with dashes replaced by underscores.
+func getPythonModule(name string) string {
+	if index := strings.Index(name, "["); index >= 0 {
+		name = name[:index]
+	}
+	return strings.ToLower(strings.Replace(name, "-", "_", -1))
+}
+
+// getSmokeChecks returns the smoke checks of every language of the configuration
+// in the order of installation. Languages without checks are skipped.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) getSmokeChecks() []smokeCheck {
+	var checks []smokeCheck
+	deps := asgmtEnv.AsgmtEnvConfig.Deps
+	for _, lang := range deps.Languages {
+		checker, found := smokeCheckers[lang.Name]
+		if !found {
+			continue
+		}
+		var provides []string
+		if script, found := scripts.Default().Get(lang.Name, lang.Version); found {
+			provides = script.Provides
+		}
+		checks = append(checks, checker(provides, deps)...)
+	}
+	return checks
+}
+
+// smokeTest runs every smoke check in a container started from the image, rendering the
+// output of each check as status events. It returns error for the first check that fails.
+func (asgmtEnv *assignmentEnvironmentImageBuilder) smokeTest(ctx context.Context) error {
+	imageRef := asgmtEnv.ImgBuildConfig.getImageReference()
+	for _, check := range asgmtEnv.getSmokeChecks() {
+		if err := asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "smoke", Message: "Running check: " + check.name}); err != nil {
+			return err
+		}
+		result, err := asgmtEnv.engine.RunContainer(ctx, imageRef, []string{"/bin/sh", "-c", check.script})
+		if err != nil {
+			return errors.Wrapf(err, "error in running smoke check %s", check.name)
+		}
+		for _, line := range strings.Split(strings.TrimRight(result.Output, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			if err := asgmtEnv.renderer.Render(ProgressEvent{Type: StatusEvent, Phase: "smoke", Message: line}); err != nil {
+				return err
+			}
+		}
+		if result.ExitCode != 0 {
+			return errors.Errorf("smoke check %s failed with exit code %d", check.name, result.ExitCode)
+		}
+	}
+	return nil
+}
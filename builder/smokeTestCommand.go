@@ -0,0 +1,47 @@
+// Package builder implements routines to write dockerfile for assignment environment,
+// build its docker image and publish it to docker hub.
+package builder
+
+import (
+	"context"
+	"strings"
+)
+
+// smokeTestCommand struct type holds assignmentEnvironmentImageBuilder instance
+// which is required to run the smoke checks against the built image.
+type smokeTestCommand struct {
+	asgmtEnv *assignmentEnvironmentImageBuilder
+}
+
+// execute invokes the smokeTest function to run the smoke checks of every language
+// in containers started from the built image.
+func (cmd *smokeTestCommand) execute(ctx context.Context) error {
+	return cmd.asgmtEnv.runPhase(ctx, "smoke", cmd.asgmtEnv.smokeTest)
+}
+
+// undo is a No operation function as the containers of the smoke checks are
+// removed once they exit, whereas the image is removed by the undo of the build.
+func (cmd *smokeTestCommand) undo() error {
+	// No operation.
+	return nil
+}
+
+// plan reports the smoke checks that would be run against the image.
+func (cmd *smokeTestCommand) plan(ctx context.Context, plan *Plan) error {
+	var names []string
+	for _, check := range cmd.asgmtEnv.getSmokeChecks() {
+		names = append(names, check.name)
+	}
+	if len(names) == 0 {
+		plan.addAction("smoke", "skip smoke checks as no language has checks")
+		return nil
+	}
+	plan.addAction("smoke", "run smoke checks in containers from %s: %s",
+		cmd.asgmtEnv.ImgBuildConfig.getImageReference(), strings.Join(names, ", "))
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *smokeTestCommand) phase() string {
+	return "smoke"
+}
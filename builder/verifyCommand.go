@@ -2,22 +2,58 @@
 // build its docker image and publish it to docker hub.
 package builder
 
+import "context"
+
 // verifyCommand struct type holds assignmentEnvironmentImageBuilder instance
-// which is required to verify language image and write the dockerfile instructions.
+// which is required to verify language image and write the dockerfile instructions,
+// and whether the resolved digests are written to the lock file of the configuration.
 type verifyCommand struct {
-	asgmtEnv *assignmentEnvironmentImageBuilder
+	asgmtEnv     *assignmentEnvironmentImageBuilder
+	writeEnvLock bool
 }
 
 // execute invokes the verifyAndWriteInstructions function to verify whether
 // a docker image for given language is already present on docker hub and accordingly
 // write dockerfile instructions for the provided assignment environment configurations.
-func (cmd *verifyCommand) execute() error {
-	return cmd.asgmtEnv.verifyAndWriteInstructions()
+// The resolved digests are then written to the lock file of the configuration, if any,
+// when the command is part of a build or an update.
+func (cmd *verifyCommand) execute(ctx context.Context) error {
+	if err := cmd.asgmtEnv.runPhase(ctx, "verify", cmd.asgmtEnv.verifyAndWriteInstructions); err != nil {
+		return err
+	}
+	if !cmd.writeEnvLock {
+		return nil
+	}
+	return cmd.asgmtEnv.writeEnvLock()
 }
 
 // undo is a No operation function as there is no possible undo to be performed
-// if the verification fails.
+// if the verification fails. The lock file is kept, as it records the resolved digests.
 func (cmd *verifyCommand) undo() error {
 	// No operation.
 	return nil
 }
+
+// plan verifies the configuration in the same way as execute, which only reads from
+// the registry, and reports the resolved image and whether the language image is reused.
+func (cmd *verifyCommand) plan(ctx context.Context, plan *Plan) error {
+	if err := cmd.asgmtEnv.runPhase(ctx, "verify", cmd.asgmtEnv.verifyAndWriteInstructions); err != nil {
+		return err
+	}
+	plan.ImageReference = cmd.asgmtEnv.ImgBuildConfig.getImageReference()
+	plan.BuildSource = cmd.asgmtEnv.getBuildSource()
+	plan.LanguageImageReused = cmd.asgmtEnv.LanguageImageExists
+	plan.ImageExists = cmd.asgmtEnv.ImageExists
+	plan.addAction("verify", "verify base image %s and language image %s",
+		cmd.asgmtEnv.AsgmtEnvConfig.BaseImage, cmd.asgmtEnv.LanguageImageRef)
+	if _, changed := cmd.asgmtEnv.getResolvedEnvLock(); changed && cmd.writeEnvLock && cmd.asgmtEnv.envLockFilepath != "" {
+		plan.addAction("verify", "write lock file %s pinning base image %s", cmd.asgmtEnv.envLockFilepath,
+			cmd.asgmtEnv.getBaseImageSource())
+	}
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *verifyCommand) phase() string {
+	return "verify"
+}
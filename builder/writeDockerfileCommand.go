@@ -2,6 +2,8 @@
 // build its docker image and publish it to docker hub.
 package builder
 
+import "context"
+
 // writeDockerfileCommand struct type holds assignmentEnvironmentImageBuilder instance
 // which is required to write the dockerfile instructions from bytes buffer
 // to an actual Dockerfile.
@@ -11,7 +13,7 @@ type writeDockerfileCommand struct {
 
 // execute invokes writeToDockerfile function to write the stored instructions
 // to the Dockerfile.
-func (cmd *writeDockerfileCommand) execute() error {
+func (cmd *writeDockerfileCommand) execute(ctx context.Context) error {
 	return cmd.asgmtEnv.writeToDockerfile()
 }
 
@@ -21,3 +23,20 @@ func (cmd *writeDockerfileCommand) undo() error {
 	cmd.asgmtEnv.resetDockerfileData()
 	return nil
 }
+
+// plan reports the dockerfile that would be written, if any.
+func (cmd *writeDockerfileCommand) plan(ctx context.Context, plan *Plan) error {
+	if cmd.asgmtEnv.ImageExists {
+		plan.addAction("write", "skip writing Dockerfile as the image already exists")
+		return nil
+	}
+	plan.DockerfileLocation = cmd.asgmtEnv.ImgBuildConfig.dockerfileLoc
+	plan.Dockerfile = cmd.asgmtEnv.DockerfileInstructions.String()
+	plan.addAction("write", "write Dockerfile to %s", plan.DockerfileLocation)
+	return nil
+}
+
+// phase returns the name of the phase performed by the command.
+func (cmd *writeDockerfileCommand) phase() string {
+	return "write"
+}
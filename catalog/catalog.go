@@ -0,0 +1,117 @@
+// Package catalog implements routines to read the catalog of the assignments of a course,
+// build the images of all their assignment environments and lock every assignment to the
+// digest of its image.
+package catalog
+
+import (
+	"assignment-exec/image-builder/configurations"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// assignmentNamePattern matches the valid names of the assignments.
+var assignmentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Catalog struct type holds the assignments of a course, each of which refers
+// to the configuration of its assignment environment.
+type Catalog struct {
+	Assignments []Assignment `yaml:"assignments"`
+}
+
+// Assignment struct type holds the name of an assignment and its assignment environment
+// configuration, given either by the path of the config file, relative to the catalog,
+// or inline.
+type Assignment struct {
+	Name           string    `yaml:"name"`
+	Path           string    `yaml:"path"`
+	Inline         yaml.Node `yaml:"config"`
+	config         *configurations.AssignmentEnvConfig
+	configFilepath string
+}
+
+// GetConfig returns the assignment environment configuration of the assignment,
+// which is read and validated once the catalog is loaded.
+func (assignment Assignment) GetConfig() *configurations.AssignmentEnvConfig {
+	return assignment.config
+}
+
+// LoadCatalog reads the catalog file and the assignment environment configuration of every
+// assignment. Every assignment is validated, and the errors of all invalid assignments are
+// returned together.
+func LoadCatalog(catalogFilepath string) (*Catalog, error) {
+	yamlFile, err := ioutil.ReadFile(catalogFilepath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read catalog file")
+	}
+	catalog := &Catalog{}
+	if err := yaml.Unmarshal(yamlFile, catalog); err != nil {
+		return nil, errors.Wrap(err, "error in unmarshaling catalog")
+	}
+	if len(catalog.Assignments) == 0 {
+		return nil, errors.New("catalog holds no assignments")
+	}
+
+	var invalid []string
+	declared := make(map[string]bool)
+	for i := range catalog.Assignments {
+		assignment := &catalog.Assignments[i]
+		if err := assignment.load(filepath.Dir(catalogFilepath), declared); err != nil {
+			name := assignment.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			invalid = append(invalid, fmt.Sprintf("assignment %s: %v", name, err))
+		}
+		declared[assignment.Name] = true
+	}
+	if len(invalid) > 0 {
+		return nil, errors.Errorf("invalid catalog:\n  %s", strings.Join(invalid, "\n  "))
+	}
+	return catalog, nil
+}
+
+// load validates the name of the assignment and reads its configuration,
+// resolving the path of the config file against the directory of the catalog.
+func (assignment *Assignment) load(catalogDir string, declared map[string]bool) error {
+	if !assignmentNamePattern.MatchString(assignment.Name) {
+		return errors.Errorf("invalid name %q", assignment.Name)
+	}
+	if declared[assignment.Name] {
+		return errors.New("declared more than once")
+	}
+
+	hasInline := assignment.Inline.Kind != 0
+	switch {
+	case assignment.Path != "" && hasInline:
+		return errors.New("cannot hold both a config path and an inline config")
+	case assignment.Path != "":
+		configFilepath := assignment.Path
+		if !filepath.IsAbs(configFilepath) {
+			configFilepath = filepath.Join(catalogDir, configFilepath)
+		}
+		config, err := configurations.GetAssignmentEnvConfig(configFilepath)
+		if err != nil {
+			return err
+		}
+		assignment.config = config
+		assignment.configFilepath = configFilepath
+	case hasInline:
+		config := &configurations.AssignmentEnvConfig{}
+		if err := assignment.Inline.Decode(config); err != nil {
+			return err
+		}
+		// The sources of the assets of an inline config are relative to the directory of the catalog.
+		if err := config.SetAssetsDir(catalogDir); err != nil {
+			return err
+		}
+		assignment.config = config
+	default:
+		return errors.New("requires either a config path or an inline config")
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+// Package catalog implements routines to read the catalog of the assignments of a course,
+// build the images of all their assignment environments and lock every assignment to the
+// digest of its image.
+package catalog
+
+import (
+	"assignment-exec/image-builder/builder"
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/history"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// The outcomes of an environment of the catalog.
+const (
+	EnvironmentBuilt   = "built"
+	EnvironmentSkipped = "skipped"
+	EnvironmentFailed  = "failed"
+)
+
+// Environment struct type holds a unique assignment environment of the catalog, i.e the names
+// of the assignments sharing it, its configuration and the registry it is published to,
+// along with the image, its digest and the outcome once the catalog has been built.
+type Environment struct {
+	Assignments  []string
+	ConfigDigest string
+	Image        string
+	Digest       string
+	Outcome      string
+	Err          error
+	config       *configurations.AssignmentEnvConfig
+	registry     string
+}
+
+// Builder struct type holds the container engine, the registry and the progress renderer
+// used to build the environments of a catalog, along with the store recording every build
+// and the lock file written by a previous build of the catalog, if any.
+type Builder struct {
+	engine       containers.ContainerEngine
+	registry     string
+	publishImage bool
+	timeouts     configurations.PhaseTimeouts
+	history      *history.Store
+	renderer     builder.ProgressRenderer
+	locked       *LockFile
+}
+
+// BuilderOption represents options that can be used to help initialize
+// an instance of Builder.
+// Each option is a closure that is responsible for initializing one or more members
+// while instantiating Builder.
+type BuilderOption func(*Builder) error
+
+// NewBuilder constructs an instance of Builder
+// by applying each of the provided options.
+// The construction of the object fails upon the failure of at least one of the given options.
+func NewBuilder(options ...BuilderOption) (*Builder, error) {
+	catalogBuilder := &Builder{publishImage: true}
+	for _, opt := range options {
+		if err := opt(catalogBuilder); err != nil {
+			return nil, errors.Wrap(err, "failed to create catalog builder instance")
+		}
+	}
+
+	// Use the docker engine if no other container engine has been provided.
+	if catalogBuilder.engine == nil {
+		engine, err := builder.NewDockerEngine()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create catalog builder instance")
+		}
+		catalogBuilder.engine = engine
+	}
+	// Render the progress as plain text on stderr if no other renderer has been provided.
+	if catalogBuilder.renderer == nil {
+		renderer, err := builder.NewProgressRenderer(builder.PlainProgress, os.Stderr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create catalog builder instance")
+		}
+		catalogBuilder.renderer = renderer
+	}
+	return catalogBuilder, nil
+}
+
+// WithContainerEngine returns a BuilderOption for initializing
+// the container engine used to build and publish the images.
+func WithContainerEngine(engine containers.ContainerEngine) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		if engine == nil {
+			return errors.New("container engine not provided")
+		}
+		catalogBuilder.engine = engine
+		return nil
+	}
+}
+
+// WithRegistry returns a BuilderOption for initializing the registry
+// that overrides the registry of every configuration.
+func WithRegistry(registryHost string) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		catalogBuilder.registry = registryHost
+		return nil
+	}
+}
+
+// WithPublishImage returns a BuilderOption for initializing whether the built images
+// are published. The digest of an image that is not published is the ID of the local image.
+func WithPublishImage(publishImage bool) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		catalogBuilder.publishImage = publishImage
+		return nil
+	}
+}
+
+// WithPhaseTimeouts returns a BuilderOption for initializing the timeouts
+// of the phases, which override the timeouts of every configuration.
+func WithPhaseTimeouts(timeouts configurations.PhaseTimeouts) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		catalogBuilder.timeouts = timeouts
+		return nil
+	}
+}
+
+// WithHistoryStore returns a BuilderOption for initializing the store
+// in which the build of every environment is recorded.
+func WithHistoryStore(store *history.Store) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		if store == nil {
+			return errors.New("history store not provided")
+		}
+		catalogBuilder.history = store
+		return nil
+	}
+}
+
+// WithProgressRenderer returns a BuilderOption for initializing
+// the renderer of the progress of the builds.
+func WithProgressRenderer(renderer builder.ProgressRenderer) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		if renderer == nil {
+			return errors.New("progress renderer not provided")
+		}
+		catalogBuilder.renderer = renderer
+		return nil
+	}
+}
+
+// WithLockFile returns a BuilderOption for initializing the lock file written by a previous
+// build of the catalog, against which the images already in the registry are checked.
+func WithLockFile(lockFile *LockFile) BuilderOption {
+	return func(catalogBuilder *Builder) error {
+		if lockFile == nil {
+			return errors.New("lock file not provided")
+		}
+		catalogBuilder.locked = lockFile
+		return nil
+	}
+}
+
+// GetEnvironments deduplicates the assignments of the catalog into their unique environments,
+// identified by the digest of the canonical form of their configuration and their registry.
+// The environments are returned in the order of their first assignment.
+func (catalogBuilder *Builder) GetEnvironments(catalog *Catalog) ([]*Environment, error) {
+	var environments []*Environment
+	environmentsByKey := make(map[string]*Environment)
+	for _, assignment := range catalog.Assignments {
+		config := assignment.GetConfig()
+		digest, err := config.GetDigest()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in assignment %s", assignment.Name)
+		}
+		registryHost := catalogBuilder.registry
+		if registryHost == "" {
+			registryHost = config.Registry
+		}
+
+		key := digest + " " + registryHost
+		environment, found := environmentsByKey[key]
+		if !found {
+			environment = &Environment{ConfigDigest: digest, config: config, registry: registryHost}
+			environmentsByKey[key] = environment
+			environments = append(environments, environment)
+		}
+		environment.Assignments = append(environment.Assignments, assignment.Name)
+	}
+	return environments, nil
+}
+
+// Build builds the image of every unique environment of the catalog, one after another.
+// The image of an environment that is already in the registry is not built again.
+// A failed environment does not stop the others. It returns the lock file of the catalog
+// along with the environments once all have been built, and error listing the failed environments, if any.
+// The assignments of a failed environment keep their entries of the previous lock file, if their
+// configuration is unchanged, whereas the others are left out of the lock file.
+func (catalogBuilder *Builder) Build(ctx context.Context, catalog *Catalog) (*LockFile, []*Environment, error) {
+	environments, err := catalogBuilder.GetEnvironments(catalog)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The assignments are locked to their images by the lock file of the catalog, whereas the lock files
+	// of their config files, which would pin the base image and language image, are not used.
+	warned := make(map[string]bool)
+	for _, assignment := range catalog.Assignments {
+		lockFilepath := configurations.GetEnvLockFilepath(assignment.configFilepath)
+		if assignment.configFilepath == "" || warned[lockFilepath] {
+			continue
+		}
+		warned[lockFilepath] = true
+		if err := builder.WarnIgnoredEnvLock(catalogBuilder.renderer, assignment.configFilepath, "catalog builds"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	workDir, err := ioutil.TempDir("", "catalog-")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error in creating work directory")
+	}
+	defer os.RemoveAll(workDir)
+
+	var failed []string
+	lockFile := &LockFile{Assignments: make(map[string]LockedImage)}
+	for i, environment := range environments {
+		dockerfileLoc := filepath.Join(workDir, fmt.Sprintf("Dockerfile.%d", i))
+		catalogBuilder.buildEnvironment(ctx, environment, dockerfileLoc)
+		if environment.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", strings.Join(environment.Assignments, ", "), environment.Err))
+			for _, name := range environment.Assignments {
+				if locked, found := catalogBuilder.getLockedImage(name); found && locked.ConfigDigest == environment.ConfigDigest &&
+					(environment.Image == "" || locked.Image == environment.Image) {
+					lockFile.Assignments[name] = locked
+				}
+			}
+			continue
+		}
+		for _, name := range environment.Assignments {
+			lockFile.Assignments[name] = LockedImage{
+				Image:        environment.Image,
+				Digest:       environment.Digest,
+				ConfigDigest: environment.ConfigDigest,
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return lockFile, environments, errors.Errorf("%d of %d environments failed:\n  %s",
+			len(failed), len(environments), strings.Join(failed, "\n  "))
+	}
+	return lockFile, environments, nil
+}
+
+// buildEnvironment verifies the configuration of the environment and skips the build if its
+// image is already in the registry, otherwise it builds, checks and publishes the image.
+// An image in the registry whose digest differs from the digest its assignments are locked to,
+// e.g as its tag has been pushed again, fails the environment rather than being locked.
+// The outcome, image and digest are set on the environment.
+func (catalogBuilder *Builder) buildEnvironment(ctx context.Context, environment *Environment, dockerfileLoc string) {
+	asgmtEnv, err := builder.NewConfigurations(catalogBuilder.publishImage, environment.registry,
+		environment.config, dockerfileLoc, builder.WithContainerEngine(catalogBuilder.engine),
+		builder.WithProgressRenderer(catalogBuilder.renderer), builder.WithPhaseTimeouts(catalogBuilder.timeouts))
+	if err == nil {
+		err = catalogBuilder.execute(ctx, builder.WithValidateCommands(asgmtEnv), false)
+	}
+	if err != nil {
+		environment.Outcome, environment.Err = EnvironmentFailed, err
+		return
+	}
+	environment.Image = asgmtEnv.GetImageReference()
+
+	digest, found, err := asgmtEnv.ResolvePublishedImage(ctx)
+	if err != nil {
+		environment.Outcome, environment.Err = EnvironmentFailed, err
+		return
+	}
+	if found {
+		for _, name := range environment.Assignments {
+			if locked, isLocked := catalogBuilder.getLockedImage(name); isLocked &&
+				locked.Image == environment.Image && locked.Digest != digest {
+				environment.Outcome, environment.Err = EnvironmentFailed, errors.Errorf(
+					"image %s in the registry has digest %s, but assignment %s is locked to %s",
+					environment.Image, digest, name, locked.Digest)
+				return
+			}
+		}
+		environment.Outcome, environment.Digest = EnvironmentSkipped, digest
+		return
+	}
+
+	// The verification is performed again by the full pipeline, on an instance of its own.
+	asgmtEnv, err = builder.NewConfigurations(catalogBuilder.publishImage, environment.registry,
+		environment.config, dockerfileLoc, builder.WithContainerEngine(catalogBuilder.engine),
+		builder.WithProgressRenderer(catalogBuilder.renderer), builder.WithPhaseTimeouts(catalogBuilder.timeouts))
+	if err == nil {
+		err = catalogBuilder.execute(ctx, builder.WithCommands(asgmtEnv, ioutil.Discard), true)
+	}
+	if err != nil {
+		environment.Outcome, environment.Err = EnvironmentFailed, err
+		return
+	}
+	environment.Outcome, environment.Digest = EnvironmentBuilt, asgmtEnv.ImageDigest
+	if environment.Digest == "" {
+		environment.Digest = asgmtEnv.ImageID
+	}
+}
+
+// getLockedImage returns the image the assignment is locked to by the previous lock file, if any.
+func (catalogBuilder *Builder) getLockedImage(name string) (LockedImage, bool) {
+	if catalogBuilder.locked == nil {
+		return LockedImage{}, false
+	}
+	locked, found := catalogBuilder.locked.Assignments[name]
+	return locked, found
+}
+
+// execute creates a build manager with the given option and executes its commands,
+// recording the execution in the history, if requested and available.
+func (catalogBuilder *Builder) execute(ctx context.Context, option builder.BuildManagerOption, record bool) error {
+	options := []builder.BuildManagerOption{option}
+	if record && catalogBuilder.history != nil {
+		options = append(options, builder.WithHistory(catalogBuilder.history))
+	}
+	buildManager, err := builder.NewBuildManager(options...)
+	if err != nil {
+		return err
+	}
+	return buildManager.ExecuteCommands(ctx)
+}
+
+// WriteSummary writes the environments as a table of the assignments sharing them,
+// their images, digests and outcomes.
+func WriteSummary(writer io.Writer, environments []*Environment) error {
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "ASSIGNMENTS\tIMAGE\tDIGEST\tRESULT\n")
+	for _, environment := range environments {
+		image, digest := environment.Image, environment.Digest
+		if image == "" {
+			image = "-"
+		}
+		if digest == "" {
+			digest = "-"
+		}
+		outcome := environment.Outcome
+		if environment.Err != nil {
+			outcome += ": " + strings.Replace(environment.Err.Error(), "\n", " ", -1)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", strings.Join(environment.Assignments, ","), image, digest, outcome)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,147 @@
+// Package catalog implements routines to read the catalog of the assignments of a course,
+// build the images of all their assignment environments and lock every assignment to the
+// digest of its image.
+package catalog
+
+import (
+	"assignment-exec/image-builder/builder"
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/builder/fake"
+	"assignment-exec/image-builder/environment"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBuildCatalog tests that the assignments sharing an environment are built once,
+// that the lock file maps every assignment to the digest of its image, that the images
+// already in the registry are not built again unless they no longer match the lock file,
+// and that the lock file holds the successful environments if others fail.
+func TestBuildCatalog(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(".."))
+	defer func() { assert.NoError(t, os.Chdir(workDir)) }()
+	assert.NoError(t, os.Setenv(environment.DockerAuthUsername, "assignmentexec"))
+	assert.NoError(t, os.Setenv(environment.DockerAuthPassword, "password"))
+
+	engine := fake.NewEngine()
+	engine.RemoteImages["assignmentexec/code-runner:1.0"] = &containers.ImageInfo{ID: "sha256:code-runner"}
+	server := httptest.NewServer(engine.RegistryHandler())
+	defer server.Close()
+	registryHost := server.Listener.Addr().String()
+
+	tempDir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	config := fmt.Sprintf("baseImage: %s/assignmentexec/code-runner:1.0\nregistry: %s\n"+
+		"dependencies:\n  lang: gcc\n  langVersion: 7\n", registryHost, registryHost)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "hw1.yaml"), []byte(config), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "assignment-env.lock"), []byte("baseImage: {}\n"), 0644))
+	inline := func(config string) string {
+		return "    config:\n      " + strings.Replace(strings.TrimSpace(config), "\n", "\n      ", -1) + "\n"
+	}
+	catalogFile := filepath.Join(tempDir, "course.yaml")
+	assert.NoError(t, ioutil.WriteFile(catalogFile, []byte("assignments:\n"+
+		"  - name: hw1\n    path: hw1.yaml\n"+
+		"  - name: hw2\n"+inline(config)+
+		"  - name: project\n"+inline(strings.Replace(config, "lang: gcc\n  langVersion: 7",
+		"lang: python\n  langVersion: 3.7", 1))), 0644))
+
+	catalog, err := LoadCatalog(catalogFile)
+	assert.NoError(t, err)
+	output := &bytes.Buffer{}
+	renderer, err := builder.NewProgressRenderer(builder.PlainProgress, output)
+	assert.NoError(t, err)
+	catalogBuilder, err := NewBuilder(WithContainerEngine(engine), WithProgressRenderer(renderer))
+	assert.NoError(t, err)
+
+	lockFile, environments, err := catalogBuilder.Build(context.Background(), catalog)
+	assert.NoError(t, err)
+	assert.Len(t, environments, 2)
+	assert.Equal(t, []string{"hw1", "hw2"}, environments[0].Assignments)
+	assert.Equal(t, EnvironmentBuilt, environments[0].Outcome)
+	assert.Equal(t, EnvironmentBuilt, environments[1].Outcome)
+	assert.Len(t, lockFile.Assignments, 3)
+	assert.Contains(t, output.String(), "Warning: lock file "+filepath.Join(tempDir, "assignment-env.lock")+
+		" is ignored by catalog builds")
+	assert.Equal(t, lockFile.Assignments["hw1"], lockFile.Assignments["hw2"])
+	assert.NotEqual(t, lockFile.Assignments["hw1"].Digest, lockFile.Assignments["project"].Digest)
+	assert.Equal(t, engine.RemoteImages[strings.SplitN(lockFile.Assignments["hw1"].Image, "/", 2)[1]].ID,
+		lockFile.Assignments["hw1"].Digest)
+
+	lockFilepath := GetLockFilepath(catalogFile)
+	assert.Equal(t, filepath.Join(tempDir, "course.lock"), lockFilepath)
+	assert.NoError(t, lockFile.Write(lockFilepath))
+	written, err := ReadLockFile(lockFilepath)
+	assert.NoError(t, err)
+	assert.Equal(t, lockFile, written)
+
+	builds := strings.Count(strings.Join(engine.Calls, "\n"), "BuildImage")
+	relocked, environments, err := catalogBuilder.Build(context.Background(), catalog)
+	assert.NoError(t, err)
+	assert.Equal(t, EnvironmentSkipped, environments[0].Outcome)
+	assert.Equal(t, EnvironmentSkipped, environments[1].Outcome)
+	assert.Equal(t, lockFile, relocked)
+	assert.Equal(t, builds, strings.Count(strings.Join(engine.Calls, "\n"), "BuildImage"))
+
+	summary := &bytes.Buffer{}
+	assert.NoError(t, WriteSummary(summary, environments))
+	assert.Contains(t, summary.String(), "hw1,hw2")
+	assert.Contains(t, summary.String(), "skipped")
+
+	// An image pushed again under its tag no longer matches the lock file, whose entries are kept.
+	imageKey := strings.SplitN(lockFile.Assignments["hw1"].Image, "/", 2)[1]
+	engine.RemoteImages[imageKey] = &containers.ImageInfo{ID: "sha256:tampered"}
+	lockedBuilder, err := NewBuilder(WithContainerEngine(engine), WithProgressRenderer(renderer), WithLockFile(written))
+	assert.NoError(t, err)
+	relocked, environments, err = lockedBuilder.Build(context.Background(), catalog)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 environments failed")
+	assert.Contains(t, environments[0].Err.Error(), "has digest sha256:tampered, but assignment hw1 is locked to "+
+		lockFile.Assignments["hw1"].Digest)
+	assert.Equal(t, EnvironmentSkipped, environments[1].Outcome)
+	assert.Equal(t, lockFile, relocked)
+
+	// The successful environments are locked even if others fail.
+	delete(engine.RemoteImages, strings.SplitN(lockFile.Assignments["project"].Image, "/", 2)[1])
+	engine.Failures["BuildImage"] = fmt.Errorf("build failed")
+	relocked, environments, err = catalogBuilder.Build(context.Background(), catalog)
+	assert.Error(t, err)
+	assert.Equal(t, EnvironmentSkipped, environments[0].Outcome)
+	assert.Equal(t, EnvironmentFailed, environments[1].Outcome)
+	assert.Len(t, relocked.Assignments, 2)
+	assert.Equal(t, "sha256:tampered", relocked.Assignments["hw1"].Digest)
+	assert.NotContains(t, relocked.Assignments, "project")
+}
+
+// TestLoadInvalidCatalog tests that the errors of all the invalid assignments of a catalog are reported.
+func TestLoadInvalidCatalog(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "catalog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	catalogFile := filepath.Join(tempDir, "course.yaml")
+	assert.NoError(t, ioutil.WriteFile(catalogFile, []byte("assignments:\n"+
+		"  - name: hw1\n    path: missing.yaml\n"+
+		"  - name: hw1\n    config:\n      baseImage: ubuntu:20.04\n"+
+		"  - name: hw 3\n"+
+		"  - name: hw4\n"), 0644))
+	_, err = LoadCatalog(catalogFile)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.yaml: no such file or directory")
+	assert.Contains(t, err.Error(), "assignment hw1: declared more than once")
+	assert.Contains(t, err.Error(), `assignment hw 3: invalid name "hw 3"`)
+	assert.Contains(t, err.Error(), "assignment hw4: requires either a config path or an inline config")
+
+	assert.NoError(t, ioutil.WriteFile(catalogFile, []byte("assignments: []\n"), 0644))
+	_, err = LoadCatalog(catalogFile)
+	assert.EqualError(t, err, "catalog holds no assignments")
+}
@@ -0,0 +1,74 @@
+// Package catalog implements routines to read the catalog of the assignments of a course,
+// build the images of all their assignment environments and lock every assignment to the
+// digest of its image.
+package catalog
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lockFileHeader is the comment written at the top of every lock file.
+const lockFileHeader = "# Generated by `image-builder catalog build`, do not edit.\n"
+
+// LockFile struct type holds the image locked for every assignment of the catalog by its name.
+type LockFile struct {
+	Assignments map[string]LockedImage `yaml:"assignments"`
+}
+
+// LockedImage struct type holds the reference and digest of the image of an assignment,
+// along with the digest of the canonical form of its configuration.
+type LockedImage struct {
+	Image        string `yaml:"image"`
+	Digest       string `yaml:"digest"`
+	ConfigDigest string `yaml:"configDigest"`
+}
+
+// GetLockFilepath returns the default location of the lock file of the catalog,
+// i.e the catalog file with the `.lock` extension.
+func GetLockFilepath(catalogFilepath string) string {
+	return strings.TrimSuffix(catalogFilepath, filepath.Ext(catalogFilepath)) + ".lock"
+}
+
+// ReadLockFile reads the lock file at the given location.
+func ReadLockFile(lockFilepath string) (*LockFile, error) {
+	data, err := ioutil.ReadFile(lockFilepath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read lock file")
+	}
+	lockFile := &LockFile{}
+	if err := yaml.Unmarshal(data, lockFile); err != nil {
+		return nil, errors.Wrap(err, "error in unmarshaling lock file")
+	}
+	return lockFile, nil
+}
+
+// Write writes the lock file to the given location, with the assignments in sorted order.
+// The file is replaced atomically, so that a reader never sees a partially written lock file.
+func (lockFile *LockFile) Write(lockFilepath string) error {
+	data, err := yaml.Marshal(lockFile)
+	if err != nil {
+		return errors.Wrap(err, "error in encoding lock file")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(lockFilepath), ".lock-")
+	if err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.WriteString(lockFileHeader + string(data)); err != nil {
+		temp.Close()
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	if err := temp.Close(); err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	return errors.Wrap(os.Rename(temp.Name(), lockFilepath), "error in writing lock file")
+}
@@ -0,0 +1,191 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultAssetMode is the mode of the asset files whose mode is not given.
+const DefaultAssetMode os.FileMode = 0644
+
+// ownerPattern matches the owner of an asset, i.e a user name or ID optionally followed by a group name or ID.
+var ownerPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// AssetConfig struct type holds a file, or the files matched by a glob, that is copied into the image,
+// i.e its path relative to the directory of the configuration, the absolute path it is copied to,
+// the octal mode of the copied files and the `user[:group]` owning them.
+// A destination ending with / is a directory, which the files are copied into.
+type AssetConfig struct {
+	Source      string `yaml:"source"`
+	Destination string `yaml:"destination"`
+	Mode        string `yaml:"mode"`
+	Owner       string `yaml:"owner"`
+}
+
+// AssetFile struct type holds a file of an asset, i.e its slash separated path relative
+// to the directory of the configuration, its path on the disk and the sha256 digest of its contents.
+type AssetFile struct {
+	Source   string
+	Path     string
+	Checksum string
+}
+
+// ResolvedAsset struct type holds an asset along with the files that its source matches,
+// in the sorted order of their paths.
+type ResolvedAsset struct {
+	AssetConfig
+	Files []AssetFile
+}
+
+// GetMode returns the mode of the files of the asset.
+func (asset AssetConfig) GetMode() os.FileMode {
+	if asset.Mode == "" {
+		return DefaultAssetMode
+	}
+	mode, _ := strconv.ParseUint(asset.Mode, 8, 32)
+	return os.FileMode(mode)
+}
+
+// isGlob returns whether the source of the asset is a glob matching any number of files.
+func (asset AssetConfig) isGlob() bool {
+	return strings.ContainsAny(asset.Source, "*?[")
+}
+
+// validate checks that the source is a relative path or glob within the directory of the configuration,
+// that the destination is absolute and is a directory if the source is a glob, that the mode
+// is an octal file mode and that the owner is a user optionally followed by a group.
+func (asset AssetConfig) validate() error {
+	if asset.Source == "" || asset.Destination == "" {
+		return errors.New("asset requires a source and a destination")
+	}
+	if path.IsAbs(asset.Source) || path.Clean(asset.Source) == ".." || strings.HasPrefix(path.Clean(asset.Source), "../") {
+		return errors.Errorf("asset source %s must be relative to the directory of the configuration", asset.Source)
+	}
+	if _, err := path.Match(asset.Source, ""); err != nil {
+		return errors.Errorf("asset source %s is not a valid glob", asset.Source)
+	}
+	if !path.IsAbs(asset.Destination) || strings.ContainsAny(asset.Destination, "\n\r") {
+		return errors.Errorf("asset destination %s must be an absolute path", asset.Destination)
+	}
+	if asset.isGlob() && !strings.HasSuffix(asset.Destination, "/") {
+		return errors.Errorf("asset destination %s of glob %s must be a directory ending with /",
+			asset.Destination, asset.Source)
+	}
+	if asset.Mode != "" {
+		if mode, err := strconv.ParseUint(asset.Mode, 8, 32); err != nil || mode > 0777 {
+			return errors.Errorf("asset mode %s is not an octal file mode, e.g 0644", asset.Mode)
+		}
+	}
+	if asset.Owner != "" && !ownerPattern.MatchString(asset.Owner) {
+		return errors.Errorf("asset owner %s is not a user optionally followed by a group, e.g runner:runner", asset.Owner)
+	}
+	return nil
+}
+
+// validateAssets checks every asset and that no asset is copied to the destination of another.
+func validateAssets(assets []AssetConfig) error {
+	destinations := make(map[string]bool)
+	for _, asset := range assets {
+		if err := asset.validate(); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(asset.Destination, "/") {
+			if destinations[asset.Destination] {
+				return errors.Errorf("asset destination %s declared more than once", asset.Destination)
+			}
+			destinations[asset.Destination] = true
+		}
+	}
+	return nil
+}
+
+// SetAssetsDir sets the directory that the sources of the assets are relative to, which is
+// the directory of the configuration file, and checks that the source of every asset matches
+// at least one file.
+func (config *AssignmentEnvConfig) SetAssetsDir(dir string) error {
+	config.assetsDir = dir
+	_, err := config.ResolveAssets()
+	return err
+}
+
+// ResolveAssets returns the assets along with the files matched by their sources and their checksums,
+// in the sorted order of their destinations and sources, so that the order in which the assets are
+// declared does not affect the image. It returns error if a source matches no file or a directory,
+// or if a file is matched by more than one asset.
+func (config AssignmentEnvConfig) ResolveAssets() ([]ResolvedAsset, error) {
+	var resolved []ResolvedAsset
+	matched := make(map[string]bool)
+	for _, asset := range config.Assets {
+		matches, err := filepath.Glob(filepath.Join(config.assetsDir, filepath.FromSlash(asset.Source)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in matching asset %s", asset.Source)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("asset %s matches no file in %s", asset.Source, getDirName(config.assetsDir))
+		}
+		sort.Strings(matches)
+
+		resolvedAsset := ResolvedAsset{AssetConfig: asset}
+		for _, match := range matches {
+			file, err := getAssetFile(config.assetsDir, match)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error in asset %s", asset.Source)
+			}
+			if matched[file.Source] {
+				return nil, errors.Errorf("asset file %s matched more than once", file.Source)
+			}
+			matched[file.Source] = true
+			resolvedAsset.Files = append(resolvedAsset.Files, file)
+		}
+		resolved = append(resolved, resolvedAsset)
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		if resolved[i].Destination != resolved[j].Destination {
+			return resolved[i].Destination < resolved[j].Destination
+		}
+		return resolved[i].Source < resolved[j].Source
+	})
+	return resolved, nil
+}
+
+// getAssetFile returns the asset file at the given path along with the checksum of its contents.
+// It returns error if the path is not a regular file.
+func getAssetFile(assetsDir string, filePath string) (AssetFile, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return AssetFile{}, err
+	}
+	relPath, err := filepath.Rel(filepath.Join(assetsDir, "."), filePath)
+	if err != nil {
+		return AssetFile{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return AssetFile{}, errors.Errorf("%s is not a regular file", filepath.ToSlash(relPath))
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return AssetFile{}, err
+	}
+	sum := sha256.Sum256(data)
+	return AssetFile{Source: filepath.ToSlash(relPath), Path: filePath, Checksum: hex.EncodeToString(sum[:])}, nil
+}
+
+// getDirName returns the name of the directory to report in errors.
+func getDirName(dir string) string {
+	if dir == "" {
+		return "the working directory"
+	}
+	return dir
+}
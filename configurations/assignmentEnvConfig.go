@@ -5,96 +5,198 @@ package configurations
 
 import (
 	"assignment-exec/image-builder/constants"
-	"assignment-exec/image-builder/environment"
+	"assignment-exec/image-builder/scripts"
 	"assignment-exec/image-builder/utilities/validation"
-	"bytes"
 	"fmt"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 )
 
-// AssignmentEnvConfig struct type holds the base image and
-// dependencies level of the configuration yaml.
+// AssignmentEnvConfig struct type holds the base image, the distro of the base image, registry,
+// dependencies, phase timeouts, code-runner, multi-stage build, assets, environment variables,
+// build arguments and working directory level of the configuration yaml, along with the directory
+// that the sources of the assets are relative to.
 type AssignmentEnvConfig struct {
-	BaseImage string       `yaml:"baseImage"`
-	Deps      Dependencies `yaml:"dependencies"`
+	BaseImage       string            `yaml:"baseImage"`
+	BaseImageDistro string            `yaml:"baseImageDistro"`
+	Registry        string            `yaml:"registry"`
+	Deps            Dependencies      `yaml:"dependencies"`
+	Timeouts        PhaseTimeouts     `yaml:"timeouts"`
+	CodeRunner      CodeRunnerConfig  `yaml:"codeRunner"`
+	MultiStage      MultiStageConfig  `yaml:"multiStage"`
+	Assets          []AssetConfig     `yaml:"assets"`
+	Env             map[string]string `yaml:"env"`
+	BuildArgs       map[string]string `yaml:"buildArgs"`
+	Workdir         string            `yaml:"workdir"`
+	assetsDir       string
 }
 
 // UnmarshalYAML unmarshals the config yaml, validates the data
 // and stores the configurations to `AssignmentEnvConfig`.
-//It returns any error encountered while unmarshaling the file.
+// It returns any error encountered while unmarshaling the file.
 func (config *AssignmentEnvConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	type tempAssignmentEnvConfig struct {
-		BaseImage string       `yaml:"baseImage"`
-		Deps      Dependencies `yaml:"dependencies"`
+		BaseImage       string            `yaml:"baseImage"`
+		BaseImageDistro string            `yaml:"baseImageDistro"`
+		Registry        string            `yaml:"registry"`
+		Deps            Dependencies      `yaml:"dependencies"`
+		Timeouts        PhaseTimeouts     `yaml:"timeouts"`
+		CodeRunner      CodeRunnerConfig  `yaml:"codeRunner"`
+		MultiStage      MultiStageConfig  `yaml:"multiStage"`
+		Assets          []AssetConfig     `yaml:"assets"`
+		Env             map[string]string `yaml:"env"`
+		BuildArgs       map[string]string `yaml:"buildArgs"`
+		Workdir         string            `yaml:"workdir"`
+		Matrix          interface{}       `yaml:"matrix"`
 	}
 	temp := &tempAssignmentEnvConfig{}
 
 	if err := unmarshal(temp); err != nil {
 		return errors.Wrap(err, "error in unmarshaling assignment environment configuration")
 	}
+	// The matrix is expanded into several configurations by GetAssignmentEnvConfigVariants.
+	if temp.Matrix != nil {
+		return errors.New("configuration holds a matrix, which expands into several configurations")
+	}
 
-	// Validates base image, language and the library dependencies.
+	// Validates base image, language, the installation scripts requirements,
+	// the library dependencies, the timeouts, the code-runner, the multi-stage build, the assets,
+	// the environment variables, the build arguments and the working directory.
 	err := validation.Validate("error in configuration",
-		ValidatorForConfig(AssignmentEnvConfig(*temp),
+		ValidatorForConfig(AssignmentEnvConfig{
+			BaseImage:       temp.BaseImage,
+			BaseImageDistro: temp.BaseImageDistro,
+			Registry:        temp.Registry,
+			Deps:            temp.Deps,
+			Timeouts:        temp.Timeouts,
+			CodeRunner:      temp.CodeRunner,
+			MultiStage:      temp.MultiStage,
+			Assets:          temp.Assets,
+			Env:             temp.Env,
+			BuildArgs:       temp.BuildArgs,
+			Workdir:         temp.Workdir},
 			withBaseImageValidator(),
 			withLanguageValidator(),
-			withLibsValidator()))
+			withScriptRequirementsValidator(),
+			withLibsValidator(),
+			withTimeoutsValidator(),
+			withCodeRunnerValidator(),
+			withMultiStageValidator(),
+			withAssetsValidator(),
+			withEnvValidator()))
 
 	if err != nil {
 		return err
 	}
 
 	config.BaseImage = temp.BaseImage
+	config.BaseImageDistro = temp.BaseImageDistro
+	config.Registry = temp.Registry
 	config.Deps = temp.Deps
+	config.Timeouts = temp.Timeouts
+	config.CodeRunner = temp.CodeRunner
+	config.MultiStage = temp.MultiStage
+	config.Assets = temp.Assets
+	config.Env = temp.Env
+	config.BuildArgs = temp.BuildArgs
+	config.Workdir = temp.Workdir
 	return nil
 }
 
-// GetInstruction returns the docker instructions for the full configuration
-// as a single string.
-func (config AssignmentEnvConfig) GetInstruction() string {
-	buf := &bytes.Buffer{}
-	buf.WriteString("FROM " + config.BaseImage)
-	buf.WriteString("\n")
-	buf.WriteString("COPY . /" + constants.CodeRunnerDir)
-	buf.WriteString("\n")
-	buf.WriteString(config.Deps.GetInstruction() + "\n")
-	return buf.String()
-}
-
-// Dependencies struct type holds the language information
+// Dependencies struct type holds the languages information
 // and library names and their installation command level of the configuration yaml.
 type Dependencies struct {
-	Language  LanguageInfo                  `yaml:",inline"`
+	Languages []LanguageInfo                `yaml:"languages"`
 	Libraries map[string]LibInstallationCmd `yaml:"lib"`
 }
 
-// GetInstruction returns the docker instructions for the dependencies
-// as a single string.
-func (langDep Dependencies) GetInstruction() string {
-	buf := &bytes.Buffer{}
-	buf.WriteString(langDep.Language.GetInstruction())
-	buf.WriteString("\n")
-	buf.WriteString("ENV " + environment.LanguageEnvKey + " " + langDep.Language.Name)
-	buf.WriteString("\n")
-	for _, installCmd := range langDep.Libraries {
-		buf.WriteString("RUN " + installCmd.GetInstruction())
-		buf.WriteString("\n")
-	}
-	return buf.String()
+// UnmarshalYAML unmarshals the dependencies, which hold either a list of languages
+// or a single language given inline by its name and version.
+// It returns any error encountered while unmarshaling the dependencies.
+func (langDep *Dependencies) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	type tempDependencies struct {
+		Language  LanguageInfo                  `yaml:",inline"`
+		Languages []LanguageInfo                `yaml:"languages"`
+		Libraries map[string]LibInstallationCmd `yaml:"lib"`
+	}
+	temp := &tempDependencies{}
+
+	if err := unmarshal(temp); err != nil {
+		return errors.Wrap(err, "error in unmarshaling dependencies")
+	}
+
+	languages := temp.Languages
+	if temp.Language != (LanguageInfo{}) {
+		if len(languages) > 0 {
+			return errors.New("dependencies cannot hold both an inline language and a list of languages")
+		}
+		languages = []LanguageInfo{temp.Language}
+	}
+
+	langDep.Languages = languages
+	langDep.Libraries = temp.Libraries
+	return nil
 }
 
-// LibInstallationCmd struct type holds the installation command
-// for the respective library name.
+// GetLibraryCommands returns the command to install
+// each library, in the sorted order of the library names.
+func (langDep Dependencies) GetLibraryCommands() ([]string, error) {
+	var commands []string
+	for _, lib := range langDep.GetLibraryNames() {
+		command, err := langDep.Libraries[lib].GetInstruction(lib, langDep.Languages)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// GetSupportedLanguages returns the value of the supported language environment
+// variable read by the code-runner, i.e the comma separated names of the languages.
+func (langDep Dependencies) GetSupportedLanguages() string {
+	var names []string
+	for _, lang := range langDep.Languages {
+		names = append(names, lang.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// GetLanguagesTag returns the name and version of every language joined
+// together, which is used to name the image providing these languages.
+func (langDep Dependencies) GetLanguagesTag() string {
+	var tags []string
+	for _, lang := range langDep.Languages {
+		tags = append(tags, lang.Name+lang.Version)
+	}
+	return strings.Join(tags, "-")
+}
+
+// LibInstallationCmd struct type holds either the raw installation command
+// for the respective library name, or the manager and version used to install it.
 type LibInstallationCmd struct {
-	Cmd string `yaml:"cmd"`
+	Cmd     string `yaml:"cmd"`
+	Manager string `yaml:"manager"`
+	Version string `yaml:"version"`
 }
 
-// GetInstruction returns the library installation command.
-func (libCmd LibInstallationCmd) GetInstruction() string {
-	return libCmd.Cmd
+// GetInstruction returns the command to install the library with the given name along with
+// the given languages. The raw installation command is returned as is, if given. It returns error
+// if the manager of the library is not supported, e.g for a configuration not yet validated.
+func (libCmd LibInstallationCmd) GetInstruction(name string, languages []LanguageInfo) (string, error) {
+	if libCmd.Cmd != "" {
+		return libCmd.Cmd, nil
+	}
+	manager, found := libraryManagers[libCmd.Manager]
+	if !found {
+		return "", errors.Errorf("library manager %s of library %s not supported", libCmd.Manager, name)
+	}
+	return manager.installCmd(name, libCmd.Version, manager.getLanguageVersion(languages)), nil
 }
 
 // LanguageInfo struct type holds name and version of language.
@@ -103,15 +205,25 @@ type LanguageInfo struct {
 	Version string `yaml:"langVersion"`
 }
 
-// GetInstruction returns the docker instruction for the language
-// as a single string. The instruction includes running the installation
-// script for the given language.
-func (langInfo LanguageInfo) GetInstruction() string {
-	return fmt.Sprintf("RUN ./%s/%s_%s.sh", constants.InstallationScriptsDir, langInfo.Name, langInfo.Version)
+// GetInstallCommand returns the command running the installation
+// script for the language.
+func (langInfo LanguageInfo) GetInstallCommand() string {
+	return fmt.Sprintf("./%s/%s_%s.sh", constants.InstallationScriptsDir, langInfo.Name, langInfo.Version)
+}
+
+// GetVerifyCommand returns the command verifying the installation of the language,
+// which fails unless the installed binaries report the expected version.
+// It returns an empty string if the installation script declares no verification.
+func (langInfo LanguageInfo) GetVerifyCommand() string {
+	script, found := scripts.Default().Get(langInfo.Name, langInfo.Version)
+	if !found {
+		return ""
+	}
+	return script.GetVerifyCommand()
 }
 
 // GetAssignmentEnvConfig reads the yaml config file and unmarshals it into
-// AssignmentEnvConfig instance.
+// AssignmentEnvConfig instance. The sources of the assets are relative to the directory of the file.
 func GetAssignmentEnvConfig(configFilepath string) (*AssignmentEnvConfig, error) {
 
 	yamlFile, err := ioutil.ReadFile(configFilepath)
@@ -124,6 +236,9 @@ func GetAssignmentEnvConfig(configFilepath string) (*AssignmentEnvConfig, error)
 	if err != nil {
 		return nil, errors.Wrap(err, "error in unmarshaling yaml: %v")
 	}
+	if err := c.SetAssetsDir(filepath.Dir(configFilepath)); err != nil {
+		return nil, errors.Wrap(err, "error in configuration")
+	}
 
 	return c, nil
 }
@@ -0,0 +1,177 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/constants"
+	"assignment-exec/image-builder/scripts"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// canonicalConfig struct type holds the canonical form of the assignment
+// environment configuration. Every field that affects the generated image
+// is present and every unordered collection is sorted, so that identical
+// configurations always produce identical canonical forms.
+type canonicalConfig struct {
+	BaseImage string              `json:"baseImage"`
+	Languages []canonicalLanguage `json:"languages"`
+	Libraries []canonicalLibrary  `json:"lib"`
+	// The multi-stage build is only present once enabled, so that the digests of the
+	// configurations built in a single stage are not affected.
+	MultiStage []string `json:"multiStageArtifacts,omitempty"`
+	// The assets are only present once declared, and hold the checksum of every file,
+	// so that changing the contents of a file changes the digest.
+	Assets []canonicalAsset `json:"assets,omitempty"`
+	// The environment variables, build arguments and working directory are only present once declared.
+	Env       []canonicalVariable `json:"env,omitempty"`
+	BuildArgs []canonicalVariable `json:"buildArgs,omitempty"`
+	Workdir   string              `json:"workdir,omitempty"`
+}
+
+// canonicalVariable struct type holds the name and value of an environment
+// variable or of a build argument in the canonical form.
+type canonicalVariable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// canonicalAsset struct type holds an asset in the canonical form, i.e the files matched by its
+// source along with their checksums, its destination, mode and owner.
+type canonicalAsset struct {
+	Files       []canonicalAssetFile `json:"files"`
+	Destination string               `json:"destination"`
+	Mode        string               `json:"mode"`
+	Owner       string               `json:"owner"`
+}
+
+// canonicalAssetFile struct type holds the path of an asset file relative to
+// the directory of the configuration and the checksum of its contents.
+type canonicalAssetFile struct {
+	Source   string `json:"source"`
+	Checksum string `json:"sha256"`
+}
+
+// canonicalLanguage struct type holds a language name and its version in the canonical
+// form, along with the checksum of its installation script, so that changing the script,
+// e.g by overriding it, changes the digest. The languages are kept in their declared
+// order, which is the order of their installation.
+type canonicalLanguage struct {
+	Name     string `json:"lang"`
+	Version  string `json:"langVersion"`
+	Checksum string `json:"scriptSha256,omitempty"`
+}
+
+// canonicalLibrary struct type holds a library name and its
+// installation command in the canonical form.
+type canonicalLibrary struct {
+	Name string `json:"name"`
+	Cmd  string `json:"cmd"`
+}
+
+// GetCanonicalForm returns the canonical form of the configuration
+// encoded as JSON.
+func (config AssignmentEnvConfig) GetCanonicalForm() ([]byte, error) {
+	canonical := canonicalConfig{
+		BaseImage: config.BaseImage,
+		Languages: []canonicalLanguage{},
+		Libraries: []canonicalLibrary{},
+	}
+	for _, lang := range config.Deps.Languages {
+		canonicalLang := canonicalLanguage{Name: lang.Name, Version: lang.Version}
+		if script, found := scripts.Default().Get(lang.Name, lang.Version); found {
+			sum := sha256.Sum256(script.Content)
+			canonicalLang.Checksum = hex.EncodeToString(sum[:])
+		}
+		canonical.Languages = append(canonical.Languages, canonicalLang)
+	}
+	for _, lib := range config.Deps.GetLibraryNames() {
+		cmd, err := config.Deps.Libraries[lib].GetInstruction(lib, config.Deps.Languages)
+		if err != nil {
+			return nil, err
+		}
+		canonical.Libraries = append(canonical.Libraries, canonicalLibrary{Name: lib, Cmd: cmd})
+	}
+
+	if config.MultiStage.Enabled {
+		canonical.MultiStage = config.MultiStage.GetArtifacts(config.Deps.Languages)
+	}
+
+	assets, err := config.ResolveAssets()
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		canonicalAsset := canonicalAsset{Destination: asset.Destination,
+			Mode: fmt.Sprintf("%04o", asset.GetMode()), Owner: asset.Owner}
+		for _, file := range asset.Files {
+			canonicalAsset.Files = append(canonicalAsset.Files, canonicalAssetFile{Source: file.Source, Checksum: file.Checksum})
+		}
+		canonical.Assets = append(canonical.Assets, canonicalAsset)
+	}
+
+	for _, name := range config.GetEnvNames() {
+		canonical.Env = append(canonical.Env, canonicalVariable{Name: name, Value: config.Env[name]})
+	}
+	for _, name := range config.GetBuildArgNames() {
+		canonical.BuildArgs = append(canonical.BuildArgs, canonicalVariable{Name: name, Value: config.BuildArgs[name]})
+	}
+	canonical.Workdir = config.Workdir
+
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in encoding canonical configuration")
+	}
+	return data, nil
+}
+
+// GetDigest returns the hex encoded sha256 digest of the canonical
+// form of the configuration.
+func (config AssignmentEnvConfig) GetDigest() (string, error) {
+	data, err := config.GetCanonicalForm()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GetLabels returns the human readable image labels describing the configuration,
+// along with the digest of its canonical form.
+func (config AssignmentEnvConfig) GetLabels() (map[string]string, error) {
+	digest, err := config.GetDigest()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		constants.LabelBaseImage:    config.BaseImage,
+		constants.LabelLanguage:     config.Deps.getLanguagesLabel(),
+		constants.LabelLibraries:    strings.Join(config.Deps.GetLibraryNames(), ","),
+		constants.LabelConfigDigest: digest,
+	}, nil
+}
+
+// GetLibraryNames returns the names of the libraries in sorted order.
+func (langDep Dependencies) GetLibraryNames() []string {
+	var names []string
+	for lib := range langDep.Libraries {
+		names = append(names, lib)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getLanguagesLabel returns the comma separated names and versions of the languages.
+func (langDep Dependencies) getLanguagesLabel() string {
+	var languages []string
+	for _, lang := range langDep.Languages {
+		languages = append(languages, lang.Name+" "+lang.Version)
+	}
+	return strings.Join(languages, ",")
+}
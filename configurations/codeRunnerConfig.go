@@ -0,0 +1,78 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/constants"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// CodeRunnerConfig struct type holds how the code-runner of the base image is started,
+// i.e the port it listens on and the arguments it is given, along with the path of its
+// health endpoint and how long it may take to start accepting connections.
+// The zero values are replaced by the defaults of the code-runner.
+type CodeRunnerConfig struct {
+	Port         int           `yaml:"port"`
+	Args         []string      `yaml:"args"`
+	HealthPath   string        `yaml:"healthPath"`
+	StartTimeout time.Duration `yaml:"startTimeout"`
+}
+
+// GetPort returns the port that the code-runner listens on.
+func (codeRunner CodeRunnerConfig) GetPort() int {
+	if codeRunner.Port == 0 {
+		return constants.DefaultCodeRunnerPort
+	}
+	return codeRunner.Port
+}
+
+// GetArgs returns the arguments that the code-runner is started with,
+// which by default give it the port to listen on.
+func (codeRunner CodeRunnerConfig) GetArgs() []string {
+	if codeRunner.Args == nil {
+		return []string{constants.PortCmdArg, fmt.Sprint(codeRunner.GetPort())}
+	}
+	return codeRunner.Args
+}
+
+// GetHealthPath returns the path of the health endpoint of the code-runner.
+func (codeRunner CodeRunnerConfig) GetHealthPath() string {
+	if codeRunner.HealthPath == "" {
+		return constants.DefaultCodeRunnerHealthPath
+	}
+	return codeRunner.HealthPath
+}
+
+// GetStartTimeout returns how long the code-runner may take to start accepting connections.
+func (codeRunner CodeRunnerConfig) GetStartTimeout() time.Duration {
+	if codeRunner.StartTimeout == 0 {
+		return constants.DefaultCodeRunnerStartTimeout
+	}
+	return codeRunner.StartTimeout
+}
+
+// GetRunCommand returns the docker command that starts the code-runner of the given image.
+func (codeRunner CodeRunnerConfig) GetRunCommand(imageRef string) string {
+	port := codeRunner.GetPort()
+	return strings.Join(append([]string{"docker", "run", "--publish", fmt.Sprintf("%d:%d", port, port), imageRef},
+		codeRunner.GetArgs()...), " ")
+}
+
+// validate checks that the port is a valid port number, the health path is absolute
+// and the start timeout is not negative.
+func (codeRunner CodeRunnerConfig) validate() error {
+	if codeRunner.Port < 0 || codeRunner.Port > 65535 {
+		return errors.Errorf("code-runner port %d is not between 1 and 65535", codeRunner.Port)
+	}
+	if codeRunner.HealthPath != "" && !strings.HasPrefix(codeRunner.HealthPath, "/") {
+		return errors.Errorf("code-runner health path %s must start with /", codeRunner.HealthPath)
+	}
+	if codeRunner.StartTimeout < 0 {
+		return errors.New("code-runner start timeout cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// matrixKey is the key of the matrix section of the configuration yaml.
+const matrixKey = "matrix"
+
+// maxMatrixVariants is the maximum number of variants that a matrix can expand into.
+const maxMatrixVariants = 64
+
+// variantNamePattern matches the valid names of the matrix entries,
+// which are used to name the files of the variants.
+var variantNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ConfigVariant struct type holds a configuration expanded from the matrix
+// along with its name, i.e the names of its matrix entries joined by dashes.
+type ConfigVariant struct {
+	Name   string
+	Config *AssignmentEnvConfig
+}
+
+// GetAssignmentEnvConfigVariants reads the yaml config file and expands its matrix into
+// the configuration variants. The matrix maps the name of each axis to a list of entries, each
+// of which is merged into the rest of the configuration. A variant is generated for every
+// combination of one entry from each axis, in the order of the axes and entries.
+// A configuration without a matrix expands into itself as a single unnamed variant.
+func GetAssignmentEnvConfigVariants(configFilepath string) ([]ConfigVariant, error) {
+	yamlFile, err := ioutil.ReadFile(configFilepath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+	variants, err := ExpandConfigMatrix(yamlFile)
+	if err != nil {
+		return nil, err
+	}
+	// The sources of the assets are relative to the directory of the file.
+	for _, variant := range variants {
+		if err := variant.Config.SetAssetsDir(filepath.Dir(configFilepath)); err != nil {
+			if variant.Name == "" {
+				return nil, errors.Wrap(err, "error in configuration")
+			}
+			return nil, errors.Wrapf(err, "error in matrix variant %s", variant.Name)
+		}
+	}
+	return variants, nil
+}
+
+// ExpandConfigMatrix expands the matrix of the configuration yaml into the configuration
+// variants, each of which is validated in the same way as a configuration without a matrix.
+func ExpandConfigMatrix(config []byte) ([]ConfigVariant, error) {
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(config, document); err != nil {
+		return nil, errors.Wrap(err, "error in unmarshaling yaml")
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("configuration must be a mapping")
+	}
+	base, matrix := removeKey(document.Content[0], matrixKey)
+
+	entries := [][]matrixEntry{{}}
+	if matrix != nil {
+		var err error
+		if entries, err = getMatrixCombinations(matrix); err != nil {
+			return nil, errors.Wrap(err, "error in matrix")
+		}
+	}
+
+	var variants []ConfigVariant
+	declared := make(map[string]bool)
+	for _, combination := range entries {
+		var names []string
+		node := base
+		for _, entry := range combination {
+			names = append(names, entry.name)
+			node = mergeNodes(node, entry.node)
+		}
+		name := strings.Join(names, "-")
+		if declared[name] {
+			return nil, errors.Errorf("matrix variant %s declared more than once", name)
+		}
+		declared[name] = true
+
+		config := &AssignmentEnvConfig{}
+		if err := node.Decode(config); err != nil {
+			if name == "" {
+				return nil, err
+			}
+			return nil, errors.Wrapf(err, "error in matrix variant %s", name)
+		}
+		variants = append(variants, ConfigVariant{Name: name, Config: config})
+	}
+	return variants, nil
+}
+
+// matrixEntry struct type holds an entry of a matrix axis,
+// i.e its name and the configuration merged into the variants.
+type matrixEntry struct {
+	name string
+	node *yaml.Node
+}
+
+// getMatrixCombinations returns every combination of one entry from each axis of the matrix.
+func getMatrixCombinations(matrix *yaml.Node) ([][]matrixEntry, error) {
+	if matrix.Kind != yaml.MappingNode || len(matrix.Content) == 0 {
+		return nil, errors.New("matrix must map the name of each axis to a list of entries")
+	}
+
+	combinations := [][]matrixEntry{{}}
+	for i := 0; i < len(matrix.Content); i += 2 {
+		axis, values := matrix.Content[i].Value, matrix.Content[i+1]
+		if values.Kind != yaml.SequenceNode || len(values.Content) == 0 {
+			return nil, errors.Errorf("axis %s must hold a list of entries", axis)
+		}
+
+		var axisEntries []matrixEntry
+		for index, value := range values.Content {
+			entry, err := getMatrixEntry(axis, index, value)
+			if err != nil {
+				return nil, err
+			}
+			axisEntries = append(axisEntries, entry)
+		}
+		if len(combinations)*len(axisEntries) > maxMatrixVariants {
+			return nil, errors.Errorf("matrix expands into more than %d variants", maxMatrixVariants)
+		}
+
+		// The entries of the first axis vary the slowest.
+		var expanded [][]matrixEntry
+		for _, combination := range combinations {
+			for _, entry := range axisEntries {
+				expanded = append(expanded, append(append([]matrixEntry{}, combination...), entry))
+			}
+		}
+		combinations = expanded
+	}
+	return combinations, nil
+}
+
+// getMatrixEntry returns the entry of the axis at the given index, which is named by its
+// `name` key, or else by the name of the axis suffixed with the position of the entry.
+func getMatrixEntry(axis string, index int, value *yaml.Node) (matrixEntry, error) {
+	if value.Kind != yaml.MappingNode {
+		return matrixEntry{}, errors.Errorf("entry %d of axis %s must be a mapping", index+1, axis)
+	}
+	node, nameNode := removeKey(value, "name")
+	name := fmt.Sprintf("%s%d", axis, index+1)
+	if nameNode != nil {
+		name = nameNode.Value
+	}
+	if !variantNamePattern.MatchString(name) {
+		return matrixEntry{}, errors.Errorf("invalid name %s of entry %d of axis %s", name, index+1, axis)
+	}
+	if _, nested := removeKey(node, matrixKey); nested != nil {
+		return matrixEntry{}, errors.Errorf("entry %s of axis %s cannot hold a matrix", name, axis)
+	}
+	return matrixEntry{name: name, node: node}, nil
+}
+
+// removeKey returns a copy of the mapping node without the given key, along with the value of the key, if any.
+func removeKey(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	result := *mapping
+	result.Content = nil
+	var value *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value = mapping.Content[i+1]
+			continue
+		}
+		result.Content = append(result.Content, mapping.Content[i], mapping.Content[i+1])
+	}
+	return &result, value
+}
+
+// mergeNodes returns the overlay merged into the base without modifying either of them.
+// Mappings are merged key by key, whereas any other value of the overlay replaces the base.
+func mergeNodes(base *yaml.Node, overlay *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+	result := *base
+	result.Content = append([]*yaml.Node{}, base.Content...)
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		merged := false
+		for j := 0; j+1 < len(result.Content); j += 2 {
+			if result.Content[j].Value == overlay.Content[i].Value {
+				result.Content[j+1] = mergeNodes(result.Content[j+1], overlay.Content[i+1])
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result.Content = append(result.Content, overlay.Content[i], overlay.Content[i+1])
+		}
+	}
+	return &result
+}
@@ -25,45 +25,115 @@ func ValidatorForConfig(cfg AssignmentEnvConfig, configValidators ...configValid
 }
 
 // withBaseImageValidator returns a configValidator for validating the given base image.
+// The presence of the base image in the registry is verified by the builder
+// using its container engine.
 func withBaseImageValidator() configValidator {
 	return func(cfg AssignmentEnvConfig) error {
 		// Base Image name cannot be empty string.
 		if cfg.BaseImage == "" {
 			return errors.New("base image name cannot be empty string")
 		}
-
-		return validateBaseImage(cfg.BaseImage)
+		return nil
 	}
 }
 
 // withLanguageValidator returns a configValidator for validating the given
-// language name and version.
+// languages names and versions.
 func withLanguageValidator() configValidator {
 	return func(cfg AssignmentEnvConfig) error {
-		// Language name and version name cannot be empty string.
-		if cfg.Deps.Language.Name == "" || cfg.Deps.Language.Version == "" {
-			return errors.New("language name and version cannot be empty string")
+		// At least one language is required.
+		if len(cfg.Deps.Languages) == 0 {
+			return errors.New("at least one language is required")
 		}
 
-		lang := cfg.Deps.Language.Name
-		version := cfg.Deps.Language.Version
-		if err := validateLang(lang, version); err != nil {
-			return errors.Wrap(err, "programming language not supported")
+		declared := make(map[LanguageInfo]bool)
+		for _, lang := range cfg.Deps.Languages {
+			// Language name and version name cannot be empty string.
+			if lang.Name == "" || lang.Version == "" {
+				return errors.New("language name and version cannot be empty string")
+			}
+			if declared[lang] {
+				return errors.Errorf("language %s %s declared more than once", lang.Name, lang.Version)
+			}
+			declared[lang] = true
+
+			if err := validateLang(lang.Name, lang.Version); err != nil {
+				return errors.Wrapf(err, "programming language %s %s not supported", lang.Name, lang.Version)
+			}
 		}
 		return nil
 	}
 }
 
-// withLibsValidator returns a configValidator for validating the given
-// libraries and their installation commands.
+// withScriptRequirementsValidator returns a configValidator for validating that the
+// installation scripts of the given languages can run on the base image, i.e that they
+// support the distro of the base image, if given, and that the tools they require are
+// present on the base image or provided by the scripts of the preceding languages.
+func withScriptRequirementsValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		return validateScriptRequirements(cfg.BaseImageDistro, cfg.Deps.Languages)
+	}
+}
+
+// withLibsValidator returns a configValidator for validating the given libraries and their
+// installation commands or managers, against the tools present on the base image and those
+// provided by the installation scripts of the languages.
 func withLibsValidator() configValidator {
 	return func(cfg AssignmentEnvConfig) error {
-		// Library installation commands cannot be empty strings.
-		for s, libInstallCmd := range cfg.Deps.Libraries {
-			if s == "" || libInstallCmd.Cmd == "" {
-				return errors.New("library installation command cannot be empty string")
+		availableTools := getAvailableTools(cfg.BaseImageDistro, cfg.Deps.Languages)
+		for _, name := range cfg.Deps.GetLibraryNames() {
+			if err := validateLibrary(name, cfg.Deps.Libraries[name], availableTools); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// withTimeoutsValidator returns a configValidator for validating the given phase timeouts.
+func withTimeoutsValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		for _, phase := range []string{"verify", "build", "publish"} {
+			if cfg.Timeouts.GetTimeout(phase) < 0 {
+				return errors.Errorf("timeout of the %s phase cannot be negative", phase)
 			}
 		}
 		return nil
 	}
 }
+
+// withCodeRunnerValidator returns a configValidator for validating how the code-runner is started.
+func withCodeRunnerValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		return cfg.CodeRunner.validate()
+	}
+}
+
+// withMultiStageValidator returns a configValidator for validating the multi-stage build.
+func withMultiStageValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		return cfg.MultiStage.validate(cfg.Deps.Languages)
+	}
+}
+
+// withAssetsValidator returns a configValidator for validating the assets.
+// The presence of their files is verified once the directory of the configuration is known.
+func withAssetsValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		return validateAssets(cfg.Assets)
+	}
+}
+
+// withEnvValidator returns a configValidator for validating the environment variables,
+// the build arguments and the working directory.
+func withEnvValidator() configValidator {
+	return func(cfg AssignmentEnvConfig) error {
+		if err := validateVariables("environment variable", cfg.Env); err != nil {
+			return err
+		}
+		if err := validateVariables("build argument", cfg.BuildArgs); err != nil {
+			return err
+		}
+		return validateWorkdir(cfg.Workdir)
+	}
+}
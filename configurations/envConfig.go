@@ -0,0 +1,89 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/environment"
+	"github.com/pkg/errors"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variableNamePattern matches the name of an environment variable or of a build argument.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretNamePattern matches the names of the variables that usually hold secrets.
+var secretNamePattern = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|CREDENTIAL)`)
+
+// secretValuePatterns match the values that look like secrets, i.e private keys, the tokens
+// of well known services, JSON web tokens and URLs holding a password.
+var secretValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b|\bgithub_pat_[A-Za-z0-9_]{22,}`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`),
+}
+
+// GetEnvNames returns the names of the environment variables in sorted order.
+func (config AssignmentEnvConfig) GetEnvNames() []string {
+	return getSortedNames(config.Env)
+}
+
+// GetBuildArgNames returns the names of the build arguments in sorted order.
+func (config AssignmentEnvConfig) GetBuildArgNames() []string {
+	return getSortedNames(config.BuildArgs)
+}
+
+// getSortedNames returns the keys of the map in sorted order.
+func getSortedNames(variables map[string]string) []string {
+	var names []string
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateVariables checks the names and values of the environment variables or build arguments,
+// which must not look like secrets, since both are stored in the image and its history.
+// The environment variables set by the image builder cannot be overridden.
+func validateVariables(kind string, variables map[string]string) error {
+	for _, name := range getSortedNames(variables) {
+		value := variables[name]
+		if !variableNamePattern.MatchString(name) {
+			return errors.Errorf("invalid %s name %q", kind, name)
+		}
+		if name == environment.LanguageEnvKey {
+			return errors.Errorf("%s %s is set by the image builder", kind, name)
+		}
+		if strings.ContainsAny(value, "\n\r\x00") {
+			return errors.Errorf("value of %s %s spans several lines", kind, name)
+		}
+		if secretNamePattern.MatchString(name) && value != "" {
+			return errors.Errorf("%s %s looks like a secret, which would be stored in the image", kind, name)
+		}
+		for _, pattern := range secretValuePatterns {
+			if pattern.MatchString(value) {
+				return errors.Errorf("value of %s %s looks like a secret, which would be stored in the image", kind, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateWorkdir checks that the working directory, if any, is a clean absolute path.
+func validateWorkdir(workdir string) error {
+	if workdir == "" {
+		return nil
+	}
+	cleaned := path.Clean(workdir)
+	if !path.IsAbs(workdir) || strings.ContainsAny(workdir, "\n\r\x00") || (cleaned != workdir && cleaned+"/" != workdir) {
+		return errors.Errorf("working directory %s must be a clean absolute path", workdir)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/constants"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// envLockHeader is the comment written at the top of every environment lock file.
+const envLockHeader = "# Generated by image-builder, refresh with `image-builder update`.\n"
+
+// EnvLock struct type holds the digests that the base image and the language image
+// of a configuration were resolved to, so that later builds use the exact same images.
+type EnvLock struct {
+	BaseImage     PinnedImage `yaml:"baseImage"`
+	LanguageImage PinnedImage `yaml:"languageImage"`
+}
+
+// PinnedImage struct type holds an image reference and the digest it was resolved to.
+// An empty digest records that the image was not present in its registry.
+type PinnedImage struct {
+	Reference string `yaml:"reference"`
+	Digest    string `yaml:"digest"`
+}
+
+// GetEnvLockFilepath returns the location of the lock file of the configuration,
+// i.e `assignment-env.lock` in the directory of the configuration file.
+func GetEnvLockFilepath(configFilepath string) string {
+	return filepath.Join(filepath.Dir(configFilepath), constants.EnvLockFilename)
+}
+
+// ReadEnvLock reads the lock file at the given location.
+// It returns nil without error if there is no lock file yet.
+func ReadEnvLock(lockFilepath string) (*EnvLock, error) {
+	data, err := ioutil.ReadFile(lockFilepath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read lock file")
+	}
+	lock := &EnvLock{}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, errors.Wrap(err, "error in unmarshaling lock file")
+	}
+	if lock.BaseImage.Reference == "" || lock.BaseImage.Digest == "" {
+		return nil, errors.Errorf("lock file %s does not pin the base image", lockFilepath)
+	}
+	return lock, nil
+}
+
+// Write writes the lock file to the given location, replacing it atomically.
+func (lock *EnvLock) Write(lockFilepath string) error {
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return errors.Wrap(err, "error in encoding lock file")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(lockFilepath), ".assignment-env.lock-")
+	if err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.WriteString(envLockHeader + string(data)); err != nil {
+		temp.Close()
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	if err := temp.Close(); err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "error in writing lock file")
+	}
+	return errors.Wrap(os.Rename(temp.Name(), lockFilepath), "error in writing lock file")
+}
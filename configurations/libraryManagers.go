@@ -0,0 +1,153 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/constants"
+	"assignment-exec/image-builder/utilities/shell"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// libraryManager struct type holds the details of a package manager used to install
+// libraries, i.e the tools that its installation command requires, the language whose
+// version the command depends on, if any, the pattern of a valid library name, whether
+// a version is required and the function to generate the pinned, non-interactive
+// installation command of a library, which is given the version of the language.
+type libraryManager struct {
+	requires        []string
+	language        string
+	namePattern     *regexp.Regexp
+	requiresVersion bool
+	installCmd      func(name string, version string, langVersion string) string
+}
+
+// versionPattern matches the versions accepted by every library manager,
+// which include wildcards and comparison operators, e.g `1.18.*` or `>=2.0`.
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9.*+~:<>=!^_-]+$`)
+
+// libraryManagers holds the supported library managers by their name.
+var libraryManagers = map[string]libraryManager{
+	"pip": {
+		requires:    []string{"pip3"},
+		language:    "python",
+		namePattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(\[[A-Za-z0-9,._-]+\])?$`),
+		installCmd: func(name string, version string, langVersion string) string {
+			if version != "" && !strings.ContainsAny(version[:1], "<>=!~") {
+				version = "==" + version
+			}
+			// The pip of the installed python version is run, rather than whichever pip3 is first on the path.
+			return "python" + langVersion + " -m pip install --no-cache-dir --no-input --disable-pip-version-check " +
+				shell.Quote(name+version)
+		},
+	},
+	"apt": {
+		requires:    []string{"apt-get"},
+		namePattern: regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+$`),
+		installCmd: func(name string, version string, _ string) string {
+			if version != "" {
+				name += "=" + version
+			}
+			return "apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends " +
+				shell.Quote(name) + " && " + constants.AptListsCleanupCmd
+		},
+	},
+	"npm": {
+		requires:    []string{"npm"},
+		namePattern: regexp.MustCompile(`^(@[a-z0-9][a-z0-9._-]*/)?[a-z0-9][a-z0-9._-]*$`),
+		installCmd: func(name string, version string, _ string) string {
+			if version != "" {
+				name += "@" + version
+			}
+			return "npm install --global --no-audit --no-fund --no-progress " + shell.Quote(name)
+		},
+	},
+	"maven": {
+		requires:        []string{"java", "apt-get"},
+		namePattern:     regexp.MustCompile(`^[A-Za-z0-9._-]+:[A-Za-z0-9._-]+$`),
+		requiresVersion: true,
+		installCmd: func(name string, version string, _ string) string {
+			// Maven is not installed along with java, so it is installed if missing.
+			return "(command -v mvn > /dev/null || (apt-get update -y && DEBIAN_FRONTEND=noninteractive " +
+				"apt-get install -y --no-install-recommends maven && " + constants.AptListsCleanupCmd + ")) && " +
+				"mvn --batch-mode --quiet dependency:get " + shell.Quote("-Dartifact="+name+":"+version)
+		},
+	},
+	"cargo": {
+		requires:    []string{"cargo"},
+		namePattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`),
+		installCmd: func(name string, version string, _ string) string {
+			// The binaries of the crate are installed on the path rather than in the home of the user.
+			cmd := "cargo install --locked --root /usr/local " + shell.Quote(name)
+			if version != "" {
+				cmd += " --version " + shell.Quote(version)
+			}
+			return cmd
+		},
+	},
+}
+
+// getLanguageVersion returns the version of the language of the manager among the given
+// languages, or an empty string if the manager depends on no language or it is not given.
+func (manager libraryManager) getLanguageVersion(languages []LanguageInfo) string {
+	for _, lang := range languages {
+		if manager.language != "" && lang.Name == manager.language {
+			return lang.Version
+		}
+	}
+	return ""
+}
+
+// getLibraryManagerNames returns the names of the supported library managers in sorted order.
+func getLibraryManagerNames() []string {
+	var names []string
+	for name := range libraryManagers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateLibrary checks that the library is either installed by a raw command or by
+// a supported manager, that its name and version are valid for the manager and that
+// the tools required by the manager are present among the given available tools.
+func validateLibrary(name string, lib LibInstallationCmd, availableTools map[string]bool) error {
+	if name == "" {
+		return errors.New("library name cannot be empty string")
+	}
+	if lib.Cmd != "" {
+		if lib.Manager != "" || lib.Version != "" {
+			return errors.Errorf("library %s cannot have both an installation command and a manager", name)
+		}
+		return nil
+	}
+	if lib.Manager == "" {
+		return errors.Errorf("library %s requires either an installation command or a manager", name)
+	}
+
+	manager, found := libraryManagers[lib.Manager]
+	if !found {
+		return errors.Errorf("library manager %s of library %s not supported, supported managers are %s",
+			lib.Manager, name, strings.Join(getLibraryManagerNames(), ", "))
+	}
+	if !manager.namePattern.MatchString(name) {
+		return errors.Errorf("invalid name for %s library %s", lib.Manager, name)
+	}
+	if lib.Version != "" && !versionPattern.MatchString(lib.Version) {
+		return errors.Errorf("invalid version %s for library %s", lib.Version, name)
+	}
+	if lib.Version == "" && manager.requiresVersion {
+		return errors.Errorf("%s library %s requires a version", lib.Manager, name)
+	}
+
+	for _, tool := range manager.requires {
+		if !availableTools[tool] {
+			return errors.Errorf("%s library %s requires %s, which is neither present on the base image nor provided by a language",
+				lib.Manager, name, tool)
+		}
+	}
+	return nil
+}
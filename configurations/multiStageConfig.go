@@ -0,0 +1,87 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import (
+	"assignment-exec/image-builder/scripts"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// MultiStageConfig struct type holds whether the image is built in multiple stages, i.e the
+// languages and libraries are installed in a build stage and only their runtime artifacts are
+// copied into a final stage starting from the base image, which installs the runtime packages
+// of the languages and the libraries again. The given artifacts are copied in addition to the
+// artifacts declared by the installation scripts.
+type MultiStageConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Artifacts []string `yaml:"artifacts"`
+}
+
+// GetArtifacts returns the absolute paths, or globs, of the runtime artifacts copied into
+// the final stage, i.e those declared by the installation script of every language followed
+// by those of the configuration, without duplicates.
+func (multiStage MultiStageConfig) GetArtifacts(languages []LanguageInfo) []string {
+	var artifacts []string
+	declared := make(map[string]bool)
+	add := func(paths []string) {
+		for _, path := range paths {
+			if !declared[path] {
+				declared[path] = true
+				artifacts = append(artifacts, path)
+			}
+		}
+	}
+	for _, lang := range languages {
+		if script, found := scripts.Default().Get(lang.Name, lang.Version); found {
+			add(script.Artifacts)
+		}
+	}
+	add(multiStage.Artifacts)
+	return artifacts
+}
+
+// GetPackages returns the runtime packages declared by the installation script
+// of every language, which are installed in the final stage, without duplicates.
+func (multiStage MultiStageConfig) GetPackages(languages []LanguageInfo) []string {
+	var packages []string
+	declared := make(map[string]bool)
+	for _, lang := range languages {
+		script, found := scripts.Default().Get(lang.Name, lang.Version)
+		if !found {
+			continue
+		}
+		for _, pkg := range script.Packages {
+			if !declared[pkg] {
+				declared[pkg] = true
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	return packages
+}
+
+// validate checks that the artifacts are absolute paths given only for a multi-stage build,
+// and that the installation script of every language declares its runtime artifacts.
+func (multiStage MultiStageConfig) validate(languages []LanguageInfo) error {
+	if !multiStage.Enabled {
+		if len(multiStage.Artifacts) > 0 {
+			return errors.New("multi-stage artifacts given without enabling the multi-stage build")
+		}
+		return nil
+	}
+	for _, artifact := range multiStage.Artifacts {
+		if !strings.HasPrefix(artifact, "/") || strings.ContainsAny(artifact, " \t\n\r") {
+			return errors.Errorf("invalid multi-stage artifact %q, artifacts must be absolute paths", artifact)
+		}
+	}
+	for _, lang := range languages {
+		script, found := scripts.Default().Get(lang.Name, lang.Version)
+		if found && len(script.Artifacts) == 0 {
+			return errors.Errorf("installation script of %s %s declares no artifacts, "+
+				"which the multi-stage build requires", lang.Name, lang.Version)
+		}
+	}
+	return nil
+}
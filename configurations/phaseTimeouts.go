@@ -0,0 +1,29 @@
+// Package configurations implements routines to read and store the
+// assignment environment configuration yaml file, get the docker instructions
+// in the specific format for every configuration.
+package configurations
+
+import "time"
+
+// PhaseTimeouts struct type holds the maximum duration of the verify, build
+// and publish phases, given as durations such as `30s` or `10m`.
+// A zero duration leaves the respective phase without a timeout.
+type PhaseTimeouts struct {
+	Verify  time.Duration `yaml:"verify"`
+	Build   time.Duration `yaml:"build"`
+	Publish time.Duration `yaml:"publish"`
+}
+
+// GetTimeout returns the timeout of the phase with the given name,
+// or zero if the phase has no timeout.
+func (timeouts PhaseTimeouts) GetTimeout(phase string) time.Duration {
+	switch phase {
+	case "verify":
+		return timeouts.Verify
+	case "build":
+		return timeouts.Build
+	case "publish":
+		return timeouts.Publish
+	}
+	return 0
+}
@@ -4,69 +4,101 @@
 package configurations
 
 import (
-	"assignment-exec/image-builder/constants"
-	"assignment-exec/image-builder/environment"
-	"context"
-	"fmt"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
+	"assignment-exec/image-builder/scripts"
 	"github.com/pkg/errors"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
 // validateLang takes language name and its version given in assignment
 // environment config and checks whether an installation script is present
-// for the same in the `scripts` directory.
+// for the same in the script registry.
 // It returns error if script is not present, which indicates provided language
 // is not supported by the application.
 func validateLang(langName string, langVersion string) error {
-	scriptName := fmt.Sprintf("%s_%s.sh", langName, langVersion)
-
 	// Check whether the given language and version are available in the installation scripts.
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return errors.Wrap(err, "error in getting current directory")
-	}
-	scriptPath := filepath.Join(currentDir, constants.InstallationScriptsDir, scriptName)
-	_, err = os.Stat(scriptPath)
-	if os.IsNotExist(err) {
+	if _, found := scripts.Default().Get(langName, langVersion); !found {
 		return errors.New("installation scripts for given language and version doesn't exists")
 	}
 	return nil
 }
 
-// validateBaseImage takes base image given in assignment environment config
-// and checks whether it is present in docker hub using the `ImageSearch` function
-// of docker client. It returns error if image is not already present, which indicates
-// that assignment environment image cannot be generated.
-func validateBaseImage(baseImage string) error {
-	backgroundContext := context.Background()
-	dockerClient, err := client.NewEnvClient()
-	if err != nil {
-		return err
-	}
-	username, hasFound := os.LookupEnv(environment.DockerAuthUsername)
-	if !hasFound {
-		return errors.New("environment variable for username not set")
+// validateScriptRequirements checks the installation scripts of the languages, in the order
+// of installation, against the distro of the base image. When the distro is not given, the
+// tools of every distro supported by a script are assumed to be present.
+// It returns error for the first script that cannot run on the base image.
+func validateScriptRequirements(distro string, languages []LanguageInfo) error {
+	if distro != "" {
+		if _, found := scripts.GetDistroTools(distro); !found {
+			return errors.Errorf("unknown base image distro %s, known distros are %s",
+				distro, strings.Join(scripts.GetDistros(), ", "))
+		}
 	}
 
-	response, err := dockerClient.ImageSearch(backgroundContext, username, types.ImageSearchOptions{
-		Limit: 25})
-	if err != nil {
-		return err
-	} else {
-		hasFound := false
-		for _, result := range response {
-			if strings.Contains(baseImage, result.Name) {
-				hasFound = true
+	provided := make(map[string]bool)
+	for _, lang := range languages {
+		script, found := scripts.Default().Get(lang.Name, lang.Version)
+		if !found {
+			continue
+		}
+		if distro != "" && !script.SupportsDistro(distro) {
+			return errors.Errorf("installation script of %s %s does not support base image distro %s, supported distros are %s",
+				lang.Name, lang.Version, distro, strings.Join(script.Distros, ", "))
+		}
+
+		available := make(map[string]bool)
+		distros := script.Distros
+		if distro != "" {
+			distros = []string{distro}
+		}
+		for _, scriptDistro := range distros {
+			tools, _ := scripts.GetDistroTools(scriptDistro)
+			for _, tool := range tools {
+				available[tool] = true
 			}
 		}
-		if !hasFound {
-			return errors.New("code-runner base image not found on docker hub")
+		for _, tool := range script.Requires {
+			if !available[tool] && !provided[tool] && len(distros) > 0 {
+				return errors.Errorf("installation script of %s %s requires %s, which is neither present on the base image nor provided by a preceding language",
+					lang.Name, lang.Version, tool)
+			}
+		}
+		for _, binary := range script.Provides {
+			provided[binary] = true
 		}
 	}
-
 	return nil
 }
+
+// getAvailableTools returns the tools available once every language is installed, i.e the tools
+// present on the base image and the binaries provided by the installation scripts. When the distro
+// of the base image is not given, the tools of every distro supported by a script, or of every known
+// distro if no script declares its distros, are assumed to be present.
+func getAvailableTools(distro string, languages []LanguageInfo) map[string]bool {
+	available := make(map[string]bool)
+	var distros []string
+	if distro != "" {
+		distros = []string{distro}
+	}
+	for _, lang := range languages {
+		script, found := scripts.Default().Get(lang.Name, lang.Version)
+		if !found {
+			continue
+		}
+		if distro == "" {
+			distros = append(distros, script.Distros...)
+		}
+		for _, binary := range script.Provides {
+			available[binary] = true
+		}
+	}
+	if len(distros) == 0 {
+		distros = scripts.GetDistros()
+	}
+	for _, scriptDistro := range distros {
+		tools, _ := scripts.GetDistroTools(scriptDistro)
+		for _, tool := range tools {
+			available[tool] = true
+		}
+	}
+	return available
+}
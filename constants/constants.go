@@ -3,10 +3,42 @@
 // environment image.
 package constants
 
+import "time"
+
 const InstallationScriptsDir = "scripts"
+
+// AssetsDir is the directory of the build context holding the files of the assets.
+const AssetsDir = "assets"
 const DockerIO = "docker.io"
-const BuildContextTar = "buildContext.tar"
 
 const CodeRunnerDir = "code-runner"
-const DockerRunCommand = "docker run --publish 52453:52453"
-const PortCmdArg = "-port 52453"
+const PortCmdArg = "-port"
+
+// DefaultCodeRunnerPort is the port that the code-runner listens on unless configured otherwise.
+const DefaultCodeRunnerPort = 52453
+
+// DefaultCodeRunnerHealthPath is the path of the health endpoint of the code-runner
+// unless configured otherwise.
+const DefaultCodeRunnerHealthPath = "/health"
+
+// DefaultCodeRunnerStartTimeout is how long the code-runner may take to start
+// accepting connections unless configured otherwise.
+const DefaultCodeRunnerStartTimeout = 30 * time.Second
+
+// TagDigestLength is the number of characters of the configuration
+// digest that are used as the image tag suffix.
+const TagDigestLength = 12
+
+const LabelBaseImage = "org.assignment-exec.base-image"
+const LabelLanguage = "org.assignment-exec.language"
+const LabelLibraries = "org.assignment-exec.libraries"
+const LabelConfigDigest = "org.assignment-exec.config-digest"
+const LabelCodeRunnerCheck = "org.assignment-exec.code-runner-check"
+const LabelCodeRunnerPort = "org.assignment-exec.code-runner-port"
+
+// EnvLockFilename is the name of the lock file generated next to the assignment
+// environment configuration, which pins the base image and language image by digest.
+const EnvLockFilename = "assignment-env.lock"
+
+// AptListsCleanupCmd removes the package lists downloaded by apt, which are not needed once the packages are installed.
+const AptListsCleanupCmd = "rm -rf /var/lib/apt/lists/*"
@@ -4,3 +4,5 @@ package environment
 var DockerAuthUsername = "DOCKER_AUTH_USERNAME"
 var DockerAuthPassword = "DOCKER_AUTH_PASSWORD"
 var LanguageEnvKey = "SUPPORTED_LANGUAGE"
+var DockerConfigDir = "DOCKER_CONFIG"
+var HistoryDir = "IMAGE_BUILDER_HISTORY_DIR"
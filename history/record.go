@@ -0,0 +1,88 @@
+// Package history implements routines to record every execution of the
+// image builder commands and to store the records on the local filesystem.
+package history
+
+import "time"
+
+// Outcome represents the result of an execution.
+type Outcome string
+
+const (
+	// Succeeded is the outcome of an execution whose commands all succeeded.
+	Succeeded Outcome = "succeeded"
+	// Failed is the outcome of an execution whose executed commands have been undone.
+	Failed Outcome = "failed"
+)
+
+// Record struct type holds the details of an execution, i.e the configuration digest,
+// the rendered Dockerfile, the resulting image, the phases executed with their timings,
+// the undo steps that ran and the outcome.
+type Record struct {
+	ID           string        `json:"id"`
+	StartedAt    time.Time     `json:"startedAt"`
+	Duration     time.Duration `json:"duration"`
+	ConfigDigest string        `json:"configDigest,omitempty"`
+	Dockerfile   string        `json:"dockerfile,omitempty"`
+	Image        string        `json:"image,omitempty"`
+	ImageID      string        `json:"imageId,omitempty"`
+	ImageDigest  string        `json:"imageDigest,omitempty"`
+	Phases       []Phase       `json:"phases"`
+	UndoSteps    []UndoStep    `json:"undoSteps,omitempty"`
+	Outcome      Outcome       `json:"outcome"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Phase struct type holds the name of an executed phase, its timing and its error, if any.
+type Phase struct {
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// UndoStep struct type holds the name of the phase whose undo ran and its error, if any.
+type UndoStep struct {
+	Phase string `json:"phase"`
+	Error string `json:"error,omitempty"`
+}
+
+// NewRecord creates and returns a new instance of Record started now.
+func NewRecord() *Record {
+	return &Record{StartedAt: time.Now().UTC(), Phases: []Phase{}}
+}
+
+// StartPhase appends the phase with the given name, started now, to the record.
+func (record *Record) StartPhase(name string) {
+	record.Phases = append(record.Phases, Phase{Name: name, StartedAt: time.Now().UTC()})
+}
+
+// EndPhase sets the duration and error of the last started phase.
+func (record *Record) EndPhase(err error) {
+	if len(record.Phases) == 0 {
+		return
+	}
+	phase := &record.Phases[len(record.Phases)-1]
+	phase.Duration = time.Since(phase.StartedAt)
+	if err != nil {
+		phase.Error = err.Error()
+	}
+}
+
+// AddUndoStep appends the undo of the phase with the given name and its error, if any, to the record.
+func (record *Record) AddUndoStep(phase string, err error) {
+	step := UndoStep{Phase: phase}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	record.UndoSteps = append(record.UndoSteps, step)
+}
+
+// Finish sets the duration and the outcome of the execution, as given by its error.
+func (record *Record) Finish(err error) {
+	record.Duration = time.Since(record.StartedAt)
+	record.Outcome = Succeeded
+	if err != nil {
+		record.Outcome = Failed
+		record.Error = err.Error()
+	}
+}
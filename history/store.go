@@ -0,0 +1,126 @@
+// Package history implements routines to record every execution of the
+// image builder commands and to store the records on the local filesystem.
+package history
+
+import (
+	"assignment-exec/image-builder/environment"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordFileExt is the extension of the files holding the records.
+const recordFileExt = ".json"
+
+// Store struct type holds the directory in which every record is stored
+// as a JSON file named after the record ID.
+type Store struct {
+	dir string
+}
+
+// NewStore creates the directory, if required, and returns a Store keeping the records in it.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("history directory not provided")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "error in creating history directory")
+	}
+	return &Store{dir: dir}, nil
+}
+
+// DefaultDir returns the directory given by the history directory environment variable,
+// or else the `.image-builder/history` directory of the home directory of the user.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(environment.HistoryDir); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "error in locating history directory")
+	}
+	return filepath.Join(home, ".image-builder", "history"), nil
+}
+
+// Save assigns an ID to the record, if it has none, and writes it to the store.
+// The IDs are ordered by the start time of the records.
+func (store *Store) Save(record *Record) error {
+	if record.ID == "" {
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return errors.Wrap(err, "error in generating record ID")
+		}
+		record.ID = record.StartedAt.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error in encoding record")
+	}
+	// The record is written to a temporary file first, so that a partially written
+	// record is never read from the store.
+	file, err := ioutil.TempFile(store.dir, "."+record.ID+"-")
+	if err != nil {
+		return errors.Wrap(err, "error in writing record")
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return errors.Wrap(err, "error in writing record")
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return errors.Wrap(err, "error in writing record")
+	}
+	return errors.Wrap(os.Rename(file.Name(), filepath.Join(store.dir, record.ID+recordFileExt)),
+		"error in writing record")
+}
+
+// Get returns the record with the given ID.
+func (store *Store) Get(id string) (*Record, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, errors.Errorf("invalid record ID %q", id)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(store.dir, id+recordFileExt))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("record %s not found", id)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in reading record %s", id)
+	}
+	record := &Record{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, errors.Wrapf(err, "error in decoding record %s", id)
+	}
+	return record, nil
+}
+
+// List returns all records in the order of their start time.
+func (store *Store) List() ([]*Record, error) {
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in listing records")
+	}
+	var records []*Record
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != recordFileExt {
+			continue
+		}
+		record, err := store.Get(strings.TrimSuffix(name, recordFileExt))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].StartedAt.Before(records[j].StartedAt)
+	})
+	return records, nil
+}
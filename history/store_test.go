@@ -0,0 +1,55 @@
+// Package history implements routines to record every execution of the
+// image builder commands and to store the records on the local filesystem.
+package history
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestStore tests saving, listing and getting the records.
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	failed := NewRecord()
+	failed.StartPhase("verify")
+	failed.EndPhase(nil)
+	failed.StartPhase("build")
+	failed.EndPhase(errors.New("build failed"))
+	failed.AddUndoStep("build", nil)
+	failed.AddUndoStep("verify", nil)
+	failed.Finish(errors.New("build failed"))
+	assert.NoError(t, store.Save(failed))
+
+	succeeded := NewRecord()
+	succeeded.StartedAt = failed.StartedAt.Add(time.Second)
+	succeeded.ConfigDigest = "digest"
+	succeeded.Finish(nil)
+	assert.NoError(t, store.Save(succeeded))
+
+	records, err := store.List()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, failed.ID, records[0].ID)
+	assert.Equal(t, Failed, records[0].Outcome)
+	assert.Equal(t, "build failed", records[0].Phases[1].Error)
+	assert.Equal(t, []UndoStep{{Phase: "build"}, {Phase: "verify"}}, records[0].UndoSteps)
+	assert.Equal(t, Succeeded, records[1].Outcome)
+
+	record, err := store.Get(succeeded.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "digest", record.ConfigDigest)
+
+	_, err = store.Get("unknown")
+	assert.EqualError(t, err, "record unknown not found")
+	_, err = store.Get("../unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"assignment-exec/image-builder/history"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runHistory lists the recorded builds, or shows the details of the build
+// whose ID is given as the argument.
+func runHistory(_ context.Context, args []string) error {
+	flagSet := flag.NewFlagSet("history", flag.ExitOnError)
+	jsonFormat := flagSet.Bool("json", false, "Print the records as JSON")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s history [options] [<id>]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() > 1 {
+		flagSet.Usage()
+		return fmt.Errorf("expected at most one record ID")
+	}
+	store, err := openHistoryStore()
+	if err != nil {
+		return err
+	}
+
+	if flagSet.NArg() == 1 {
+		record, err := store.Get(flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *jsonFormat {
+			return writeJSON(record)
+		}
+		return writeRecord(record)
+	}
+
+	records, err := store.List()
+	if err != nil {
+		return err
+	}
+	if *jsonFormat {
+		return writeJSON(records)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "ID\tSTARTED\tDURATION\tPHASES\tOUTCOME\tIMAGE\n")
+	for _, record := range records {
+		var phases []string
+		for _, phase := range record.Phases {
+			phases = append(phases, phase.Name)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", record.ID, record.StartedAt.Local().Format(time.RFC3339),
+			record.Duration.Round(time.Millisecond), strings.Join(phases, ","), record.Outcome, record.Image)
+	}
+	return writer.Flush()
+}
+
+// writeRecord prints the details of the record in a human readable form.
+func writeRecord(record *history.Record) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "ID:\t%s\n", record.ID)
+	fmt.Fprintf(writer, "Started:\t%s\n", record.StartedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(writer, "Duration:\t%s\n", record.Duration.Round(time.Millisecond))
+	fmt.Fprintf(writer, "Outcome:\t%s\n", record.Outcome)
+	if record.Error != "" {
+		fmt.Fprintf(writer, "Error:\t%s\n", record.Error)
+	}
+	fmt.Fprintf(writer, "Config digest:\t%s\n", record.ConfigDigest)
+	fmt.Fprintf(writer, "Image:\t%s\n", record.Image)
+	fmt.Fprintf(writer, "Image ID:\t%s\n", record.ImageID)
+	fmt.Fprintf(writer, "Image digest:\t%s\n", record.ImageDigest)
+	fmt.Fprintf(writer, "Phases:\t\n")
+	for _, phase := range record.Phases {
+		fmt.Fprintf(writer, "  %s\t%s", phase.Name, phase.Duration.Round(time.Millisecond))
+		if phase.Error != "" {
+			fmt.Fprintf(writer, " (%s)", phase.Error)
+		}
+		fmt.Fprintf(writer, "\n")
+	}
+	if len(record.UndoSteps) > 0 {
+		fmt.Fprintf(writer, "Undo steps:\t\n")
+		for _, step := range record.UndoSteps {
+			fmt.Fprintf(writer, "  %s\t", step.Phase)
+			if step.Error != "" {
+				fmt.Fprintf(writer, "%s", step.Error)
+			} else {
+				fmt.Fprintf(writer, "ok")
+			}
+			fmt.Fprintf(writer, "\n")
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if record.Dockerfile != "" {
+		fmt.Printf("\nDockerfile:\n")
+		for _, line := range strings.Split(strings.TrimRight(record.Dockerfile, "\n"), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// writeJSON prints the value as indented JSON.
+func writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -2,28 +2,88 @@ package main
 
 import (
 	"assignment-exec/image-builder/builder"
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
-var publishImage = flag.Bool("publishImage", false, "Publish image to docker hub")
+var publishImage = flag.Bool("publishImage", false, "Publish image to the registry")
+var registry = flag.String("registry", "", "Registry to verify and publish images against (overrides the config, defaults to docker.io)")
 var assignmentEnvConfigFilepath = flag.String("assignmentEnvConfigFilepath", "assignment-env.yaml", "Assignment Environment configuration filepath")
 var dockerfileLoc = flag.String("dockerfileLoc", "Dockerfile", "Location for dockerfile to be created")
+var progress = flag.String("progress", builder.AutoProgress, "Progress output format (auto, plain, tty or json)")
+var plan = addPlanFlags(flag.CommandLine)
+var timeouts = addTimeoutFlags(flag.CommandLine)
+var scriptsDir = addScriptsDirFlag(flag.CommandLine)
+var verbose = addVerboseFlag(flag.CommandLine)
 
 func main() {
 
+	// Cancel the context upon SIGINT or SIGTERM, so that the running
+	// commands stop and the executed commands are undone.
+	ctx := newSignalContext()
+
+	// Run the subcommand if one is given, otherwise run the full pipeline.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runSubcommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("error in %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	flag.Usage = usage
 	flag.Parse()
+	if err := useScriptsDir(*scriptsDir); err != nil {
+		log.Fatalf("error in reading installation scripts: %v", err)
+	}
 
-	asgmtEnv, err := builder.GetConfigurations(*publishImage, *assignmentEnvConfigFilepath, *dockerfileLoc)
+	renderer, err := builder.NewProgressRenderer(*progress, os.Stderr)
 	if err != nil {
-		log.Fatalf("error in getting configurations: %v", err)
+		log.Fatalf("error in creating progress renderer: %v", err)
 	}
 
-	buildManager, err := builder.NewBuildManager(builder.WithCommands(asgmtEnv))
+	asgmtEnv, err := builder.GetConfigurations(*publishImage, *registry, *assignmentEnvConfigFilepath,
+		*dockerfileLoc, builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(timeouts.get()),
+		builder.WithVerbose(*verbose))
 	if err != nil {
-		log.Fatalf("error in creating a builder: %v", err)
+		log.Fatalf("error in getting configurations: %v", err)
 	}
-	if err = buildManager.ExecuteCommands(); err != nil {
+
+	if err = execute(ctx, builder.WithCommands(asgmtEnv, os.Stdout), plan); err != nil {
 		log.Fatalf("error in building assignment environment image: %v", err)
 	}
 }
+
+// newSignalContext returns a context that is cancelled upon the first SIGINT or SIGTERM.
+// The default behaviour of the signals is restored afterwards, so that a second
+// signal terminates the image builder without waiting for the undo to complete.
+func newSignalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		log.Printf("received %v, cancelling", sig)
+		cancel()
+	}()
+	return ctx
+}
+
+// usage prints the usage of the subcommands and of the flags
+// for running the full pipeline.
+func usage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: %s <subcommand> [options]\n\nSubcommands:\n", os.Args[0])
+	for _, cmd := range subcommands {
+		fmt.Fprintf(output, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(output, "\nUse `%s <subcommand> -h` for the options of a subcommand.\n", os.Args[0])
+	fmt.Fprintf(output, "\nWithout a subcommand the image is verified, built and optionally published:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,285 @@
+// Package registry implements routines to refer to images on any registry
+// implementing the Docker Registry HTTP API v2 and to query their manifests.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestMediaTypes are the manifest media types accepted from the registry.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// Credentials struct type holds the username and password
+// used to authenticate with a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Client struct type holds the http client and the credentials
+// of each registry, required to query the registries.
+type Client struct {
+	httpClient  *http.Client
+	credentials map[string]Credentials
+}
+
+// ClientOption represents options that can be used to help initialize
+// an instance of Client.
+// Each option is a closure that is responsible for initializing one or more members
+// while instantiating Client.
+type ClientOption func(*Client) error
+
+// NewClient constructs an instance of Client
+// by applying each of the provided options.
+// The construction of the object fails upon the failure of at least one of the given options.
+func NewClient(options ...ClientOption) (*Client, error) {
+	client := &Client{httpClient: http.DefaultClient, credentials: make(map[string]Credentials)}
+	for _, opt := range options {
+		if err := opt(client); err != nil {
+			return nil, errors.Wrap(err, "failed to create registry client instance")
+		}
+	}
+	return client, nil
+}
+
+// WithHTTPClient returns a ClientOption for initializing the http client.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(client *Client) error {
+		if httpClient == nil {
+			return errors.New("http client not provided")
+		}
+		client.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithCredentials returns a ClientOption for initializing the credentials
+// used to authenticate with the given registry.
+func WithCredentials(registry string, username string, password string) ClientOption {
+	return func(client *Client) error {
+		if username == "" {
+			return errors.New("registry username not provided")
+		}
+		client.credentials[NormalizeRegistry(registry)] = Credentials{Username: username, Password: password}
+		return nil
+	}
+}
+
+// ErrManifestNotFound is returned when the registry does not hold
+// a manifest for the referenced image.
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// IsNotFound checks whether the error indicates that the referenced image is not present.
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrManifestNotFound
+}
+
+// Resolve checks whether the exact referenced image, i.e the repository with the given
+// tag, is present on its registry and returns the digest of its manifest.
+// It returns ErrManifestNotFound if the image is not present.
+func (client *Client) Resolve(ctx context.Context, ref Reference) (string, error) {
+	response, err := client.requestManifest(ctx, http.MethodHead, ref)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if err := checkManifestStatus(response, ref); err != nil {
+		return "", err
+	}
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Registries are not required to send the digest header, in which case
+	// the digest is computed from the manifest itself.
+	response, err = client.requestManifest(ctx, http.MethodGet, ref)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if err := checkManifestStatus(response, ref); err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, response.Body); err != nil {
+		return "", errors.Wrapf(err, "error in reading manifest of %s", ref)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkManifestStatus returns the error corresponding to the status of a manifest response.
+func checkManifestStatus(response *http.Response, ref Reference) error {
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errors.Wrapf(ErrManifestNotFound, "image %s", ref)
+	}
+	return errors.Errorf("unexpected status %s for manifest of %s", response.Status, ref)
+}
+
+// requestManifest sends a request for the manifest of the referenced image,
+// authenticating with the registry if challenged to do so.
+func (client *Client) requestManifest(ctx context.Context, method string, ref Reference) (*http.Response, error) {
+	scheme := "https"
+	if isInsecureRegistry(ref.Registry) {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, apiHost(ref.Registry), ref.Repository, ref.Tag)
+
+	newRequest := func(authorization string) (*http.Request, error) {
+		request, err := http.NewRequest(method, manifestURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error in creating manifest request")
+		}
+		request = request.WithContext(ctx)
+		request.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		return request, nil
+	}
+
+	request, err := newRequest("")
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in requesting manifest of %s", ref)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		return response, nil
+	}
+
+	// Authenticate as per the challenge of the registry and retry.
+	challenge := response.Header.Get("WWW-Authenticate")
+	response.Body.Close()
+	authorization, err := client.authorize(ctx, ref, challenge)
+	if err != nil {
+		return nil, err
+	}
+	request, err = newRequest(authorization)
+	if err != nil {
+		return nil, err
+	}
+	response, err = client.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in requesting manifest of %s", ref)
+	}
+	return response, nil
+}
+
+// authorize returns the value of the authorization header that answers the given
+// `WWW-Authenticate` challenge of the registry, using the credentials of the registry if any.
+// [cite: https://docs.docker.com/registry/spec/auth/token/].
+func (client *Client) authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	credentials, hasCredentials := client.credentials[ref.Registry]
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCredentials {
+			return "", errors.Errorf("credentials for registry %s not provided", ref.Registry)
+		}
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(credentials.Username, credentials.Password)
+		return request.Header.Get("Authorization"), nil
+	case "bearer":
+		tokenURL, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", errors.Errorf("invalid authentication realm in challenge %q", challenge)
+		}
+		query := tokenURL.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+		}
+		query.Set("scope", scope)
+		tokenURL.RawQuery = query.Encode()
+
+		request, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return "", errors.Wrap(err, "error in creating token request")
+		}
+		request = request.WithContext(ctx)
+		if hasCredentials {
+			request.SetBasicAuth(credentials.Username, credentials.Password)
+		}
+		response, err := client.httpClient.Do(request)
+		if err != nil {
+			return "", errors.Wrap(err, "error in requesting registry token")
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return "", errors.Errorf("unexpected status %s while requesting registry token", response.Status)
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+			return "", errors.Wrap(err, "error in decoding registry token")
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", errors.Errorf("unsupported authentication challenge %q from registry %s", challenge, ref.Registry)
+}
+
+// parseChallenge parses a `WWW-Authenticate` header value of the form
+// `scheme key="value",key="value"` into the scheme and its parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		index := strings.Index(rest, "=")
+		if index < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:index])
+		rest = rest[index+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.Index(rest, ","); end >= 0 {
+			value, rest = rest[:end], rest[end:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[strings.ToLower(key)] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
@@ -0,0 +1,103 @@
+// Package registry implements routines to refer to images on any registry
+// implementing the Docker Registry HTTP API v2 and to query their manifests.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeRegistry starts a registry that serves the given manifests, keyed by
+// `repository:tag`, behind token authentication as done by docker hub.
+// Manifests of the `nodigest` repository are served without the digest header.
+func newFakeRegistry(manifests map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/token", func(writer http.ResponseWriter, request *http.Request) {
+		username, password, ok := request.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(writer, `{"token":"token-for-%s"}`, request.URL.Query().Get("scope"))
+	})
+	mux.HandleFunc("/v2/", func(writer http.ResponseWriter, request *http.Request) {
+		path := strings.TrimPrefix(request.URL.Path, "/v2/")
+		index := strings.LastIndex(path, "/manifests/")
+		repository, tag := path[:index], path[index+len("/manifests/"):]
+
+		scope := fmt.Sprintf("repository:%s:pull", repository)
+		if request.Header.Get("Authorization") != "Bearer token-for-"+scope {
+			writer.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="fake-registry",scope="%s"`, server.URL, scope))
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		manifest, found := manifests[repository+":"+tag]
+		if !found {
+			http.NotFound(writer, request)
+			return
+		}
+		if repository != "nodigest" {
+			writer.Header().Set("Docker-Content-Digest", "sha256:"+repository+"-"+tag)
+		}
+		if request.Method == http.MethodGet {
+			_, _ = writer.Write([]byte(manifest))
+		}
+	})
+	return server
+}
+
+// TestResolve tests that only the exact repository and tag are resolved
+// and that the digest of the manifest is returned.
+func TestResolve(t *testing.T) {
+	server := newFakeRegistry(map[string]string{
+		"user/gcc7-numpy:latest": "{}",
+		"user/python3.7:1.0":     "{}",
+		"nodigest:latest":        "{}",
+	})
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client, err := NewClient(WithCredentials(host, "user", "secret"))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	digest, err := client.Resolve(ctx, ParseReference(host+"/user/python3.7:1.0"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:user/python3.7-1.0", digest)
+
+	// A repository whose name contains the requested name is not a match.
+	_, err = client.Resolve(ctx, ParseReference(host+"/user/gcc7"))
+	assert.True(t, IsNotFound(err))
+
+	// The tag must match as well.
+	_, err = client.Resolve(ctx, ParseReference(host+"/user/python3.7"))
+	assert.True(t, IsNotFound(err))
+
+	// The digest is computed from the manifest if the registry does not send it.
+	digest, err = client.Resolve(ctx, ParseReference(host+"/nodigest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", digest)
+}
+
+// TestResolveWithoutCredentials tests that resolving fails when
+// the registry refuses to issue a token.
+func TestResolveWithoutCredentials(t *testing.T) {
+	server := newFakeRegistry(map[string]string{"user/python3.7:1.0": "{}"})
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client, err := NewClient()
+	assert.NoError(t, err)
+	_, err = client.Resolve(context.Background(), ParseReference(host+"/user/python3.7:1.0"))
+	assert.Error(t, err)
+	assert.False(t, IsNotFound(err))
+}
@@ -0,0 +1,109 @@
+// Package registry implements routines to refer to images on any registry
+// implementing the Docker Registry HTTP API v2 and to query their manifests.
+package registry
+
+import (
+	"assignment-exec/image-builder/constants"
+	"strings"
+)
+
+// DefaultTag is the tag used when an image reference does not specify one.
+const DefaultTag = "latest"
+
+// dockerHubAPIHost is the host serving the registry API for docker hub.
+const dockerHubAPIHost = "registry-1.docker.io"
+
+// Reference struct type holds the registry host, the repository
+// and the tag (or digest) that together identify an image.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses an image reference of the form `[registry/]repository[:tag][@digest]`.
+// The digest identifies the image if given, in which case the tag is dropped.
+// As with docker, the first component of the reference is considered to be a registry host
+// if it contains a `.` or a `:`, or if it is `localhost`. If no registry host is present,
+// then the image is assumed to be on docker hub.
+func ParseReference(ref string) Reference {
+	reference := Reference{Registry: constants.DockerIO, Tag: DefaultTag}
+
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) == 2 && isRegistryHost(parts[0]) {
+		reference.Registry = NormalizeRegistry(parts[0])
+		ref = parts[1]
+	}
+
+	digest := ""
+	if index := strings.Index(ref, "@"); index >= 0 {
+		digest = ref[index+1:]
+		ref = ref[:index]
+	}
+	if index := strings.LastIndex(ref, ":"); index > strings.LastIndex(ref, "/") {
+		reference.Tag = ref[index+1:]
+		ref = ref[:index]
+	}
+	if digest != "" {
+		reference.Tag = digest
+	}
+
+	// Official images on docker hub reside in the `library` namespace.
+	if reference.Registry == constants.DockerIO && !strings.Contains(ref, "/") {
+		ref = "library/" + ref
+	}
+	reference.Repository = ref
+	return reference
+}
+
+// NewReference creates a reference to the repository on the given registry with the given tag.
+func NewReference(registry string, repository string, tag string) Reference {
+	if tag == "" {
+		tag = DefaultTag
+	}
+	return Reference{Registry: NormalizeRegistry(registry), Repository: repository, Tag: tag}
+}
+
+// String returns the fully qualified image reference.
+func (ref Reference) String() string {
+	separator := ":"
+	if strings.Contains(ref.Tag, ":") {
+		separator = "@"
+	}
+	return ref.Registry + "/" + ref.Repository + separator + ref.Tag
+}
+
+// NormalizeRegistry returns the canonical name of the registry host.
+// An empty host and the various docker hub hosts all refer to docker hub.
+func NormalizeRegistry(registry string) string {
+	registry = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://"), "/")
+	switch registry {
+	case "", "index.docker.io", dockerHubAPIHost:
+		return constants.DockerIO
+	}
+	return registry
+}
+
+// isRegistryHost checks whether the first component of an image
+// reference refers to a registry host.
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// isInsecureRegistry checks whether the registry is a local registry that is
+// served over plain HTTP, e.g a `registry:2` container listening on localhost.
+func isInsecureRegistry(registry string) bool {
+	host := registry
+	if index := strings.LastIndex(host, ":"); index >= 0 {
+		host = host[:index]
+	}
+	return host == "localhost" || host == "127.0.0.1" || host == "[::1]"
+}
+
+// apiHost returns the host serving the registry API for the registry.
+func apiHost(registry string) string {
+	if registry == constants.DockerIO {
+		return dockerHubAPIHost
+	}
+	return registry
+}
@@ -0,0 +1,30 @@
+// Package registry implements routines to refer to images on any registry
+// implementing the Docker Registry HTTP API v2 and to query their manifests.
+package registry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestParseReference tests the parsing of image references
+// with and without registry hosts, tags and digests.
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"assignmentexec/code-runner:1.0": {Registry: "docker.io", Repository: "assignmentexec/code-runner", Tag: "1.0"},
+		"ubuntu":                         {Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"},
+		"index.docker.io/user/gcc7":      {Registry: "docker.io", Repository: "user/gcc7", Tag: "latest"},
+		"localhost:5000/user/gcc7:2":     {Registry: "localhost:5000", Repository: "user/gcc7", Tag: "2"},
+		"ghcr.io/org/team/python3.7@sha256:abc": {Registry: "ghcr.io", Repository: "org/team/python3.7",
+			Tag: "sha256:abc"},
+		"localhost:5000/user/gcc7:2@sha256:abc": {Registry: "localhost:5000", Repository: "user/gcc7", Tag: "sha256:abc"},
+		"ubuntu:20.04@sha256:abc":               {Registry: "docker.io", Repository: "library/ubuntu", Tag: "sha256:abc"},
+	}
+	for ref, expected := range tests {
+		assert.Equal(t, expected, ParseReference(ref), ref)
+	}
+
+	assert.Equal(t, "localhost:5000/user/gcc7:2", ParseReference("localhost:5000/user/gcc7:2").String())
+	assert.Equal(t, "ghcr.io/org/python3.7@sha256:abc", ParseReference("ghcr.io/org/python3.7@sha256:abc").String())
+	assert.Equal(t, "docker.io/user/gcc7:latest", NewReference("", "user/gcc7", "").String())
+}
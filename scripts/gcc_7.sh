@@ -1,5 +1,13 @@
 #!/bin/bash
 
 # Installation commands for gcc 7
+# distros: debian ubuntu
+# requires: apt-get
+# provides: gcc-7
+# artifacts: /usr/bin/gcc-7 /usr/bin/x86_64-linux-gnu-gcc-7 /usr/lib/gcc/x86_64-linux-gnu/7
+# packages: binutils libc6-dev libgmp10 libmpfr6 libmpc3 libisl19 zlib1g
+# verify: gcc-7 --version
+# expect: gcc-7
+set -e
 apt-get update -y
 apt-get install -y gcc-7
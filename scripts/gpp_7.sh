@@ -1,6 +1,17 @@
 #!/bin/bash
 
 # Installation commands for g++ 7
+# distros: ubuntu
+# requires: apt-get
+# provides: g++-7 add-apt-repository
+# artifacts: /usr/bin/g++-7 /usr/bin/x86_64-linux-gnu-g++-7 /usr/bin/gcc-7 /usr/bin/x86_64-linux-gnu-gcc-7 /usr/lib/gcc/x86_64-linux-gnu/7
+# packages: binutils libc6-dev libstdc++-7-dev libgmp10 libmpfr6 libmpc3 libisl19 zlib1g
+# verify: g++-7 --version
+# expect: g++-7
+set -e
+apt-get update -y
+# add-apt-repository is not installed by default, it is provided by software-properties-common.
+apt-get install -y software-properties-common
 add-apt-repository ppa:ubuntu-toolchain-r/test -y
 apt-get update -y
 apt-get install g++-7 -y
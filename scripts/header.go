@@ -0,0 +1,173 @@
+// Package scripts implements the registry of the language installation scripts,
+// which are embedded in the binary and can be overridden by the scripts of a directory.
+package scripts
+
+import (
+	"assignment-exec/image-builder/utilities/shell"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// headerFieldPattern matches a field of the script header, e.g `# provides: gcc-7`.
+var headerFieldPattern = regexp.MustCompile(`^([a-z]+):\s*(.*)$`)
+
+// packagePattern matches the name of an apt package, e.g `libstdc++-7-dev`.
+var packagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+$`)
+
+// distroTools holds the tools that are available on the base images of every known distro.
+var distroTools = map[string][]string{
+	"debian": {"sh", "bash", "apt", "apt-get", "dpkg"},
+	"ubuntu": {"sh", "bash", "apt", "apt-get", "dpkg"},
+	"alpine": {"sh", "apk"},
+}
+
+// header struct type holds the description and the fields of the header comment of a script.
+type header struct {
+	description string
+	distros     []string
+	provides    []string
+	requires    []string
+	artifacts   []string
+	packages    []string
+	verify      string
+	expect      string
+}
+
+// parseHeader parses the header comment of the script, i.e the comment lines that follow the shebang.
+// The first line describes the script, and the lines formatted as `<field>: <value>` declare
+//   - distros, the space separated distros of the base images supported by the script,
+//   - provides, the space separated binaries that the script installs,
+//   - requires, the space separated tools that must be present to run the script,
+//   - artifacts, the space separated absolute paths, or globs, of the files that the installed
+//     language requires at runtime, which are copied into the final stage of a multi-stage build,
+//   - packages, the space separated apt packages that the installed language requires at runtime
+//     besides its artifacts, e.g the assembler and linker of a compiler, which are installed in the
+//     final stage of a multi-stage build,
+//   - verify, the command run once the script is installed to verify the installation,
+//   - expect, the text expected in the output of the verify command.
+func parseHeader(content []byte) (header, error) {
+	parsed := header{}
+	lines := strings.Split(string(content), "\n")
+	started := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#!") || (line == "" && !started) {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if !started {
+			started = true
+			if !headerFieldPattern.MatchString(comment) {
+				parsed.description = comment
+				continue
+			}
+		}
+
+		field := headerFieldPattern.FindStringSubmatch(comment)
+		if field == nil {
+			continue
+		}
+		value := strings.TrimSpace(field[2])
+		switch field[1] {
+		case "distros":
+			parsed.distros = strings.Fields(value)
+		case "provides":
+			parsed.provides = strings.Fields(value)
+		case "requires":
+			parsed.requires = strings.Fields(value)
+		case "artifacts":
+			parsed.artifacts = strings.Fields(value)
+		case "packages":
+			parsed.packages = strings.Fields(value)
+		case "verify":
+			parsed.verify = value
+		case "expect":
+			parsed.expect = value
+		default:
+			return header{}, errors.Errorf("unknown header field %s", field[1])
+		}
+	}
+
+	for _, distro := range parsed.distros {
+		if _, found := distroTools[distro]; !found {
+			return header{}, errors.Errorf("unknown distro %s, known distros are %s", distro, strings.Join(GetDistros(), ", "))
+		}
+	}
+	for _, artifact := range parsed.artifacts {
+		if !strings.HasPrefix(artifact, "/") {
+			return header{}, errors.Errorf("artifact %s is not an absolute path", artifact)
+		}
+	}
+	if len(parsed.packages) > 0 && !requiresApt(parsed.requires) {
+		return header{}, errors.New("runtime packages declared without requiring apt-get")
+	}
+	for _, pkg := range parsed.packages {
+		if !packagePattern.MatchString(pkg) {
+			return header{}, errors.Errorf("invalid runtime package %s", pkg)
+		}
+	}
+	if parsed.expect != "" && parsed.verify == "" {
+		return header{}, errors.New("expected output declared without a verify command")
+	}
+	return parsed, nil
+}
+
+// requiresApt checks whether the given required tools include apt.
+func requiresApt(requires []string) bool {
+	for _, tool := range requires {
+		if tool == "apt-get" || tool == "apt" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDistros returns the names of the known distros in sorted order.
+func GetDistros() []string {
+	var distros []string
+	for distro := range distroTools {
+		distros = append(distros, distro)
+	}
+	sort.Strings(distros)
+	return distros
+}
+
+// GetDistroTools returns the tools available on the base images of the given distro.
+func GetDistroTools(distro string) ([]string, bool) {
+	tools, found := distroTools[distro]
+	return tools, found
+}
+
+// SupportsDistro checks whether the script supports the base images of the given distro.
+// A script that declares no distros supports every distro.
+func (script Script) SupportsDistro(distro string) bool {
+	if len(script.Distros) == 0 {
+		return true
+	}
+	for _, supported := range script.Distros {
+		if supported == distro {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresApt checks whether the script requires apt, which installs the packages of the script.
+func (script Script) RequiresApt() bool {
+	return requiresApt(script.Requires)
+}
+
+// GetVerifyCommand returns the command that verifies the installation of the script,
+// which fails unless the output of the verify command holds the expected output, if any.
+// It returns an empty string if the script declares no verify command.
+func (script Script) GetVerifyCommand() string {
+	if script.Verify == "" || script.Expect == "" {
+		return script.Verify
+	}
+	return script.Verify + " 2>&1 | grep -F " + shell.Quote(script.Expect)
+}
@@ -1,5 +1,12 @@
 #!/bin/bash
 
 # Installation commands for java 11
-apt update -y
-apt install -y default-jdk
\ No newline at end of file
+# distros: debian ubuntu
+# requires: apt-get
+# provides: java javac
+# artifacts: /usr/lib/jvm /etc/alternatives /usr/bin/java /usr/bin/javac
+# verify: java -version
+# expect: version "11
+set -e
+apt-get update -y
+apt-get install -y default-jdk
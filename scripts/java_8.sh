@@ -1,16 +1,23 @@
 #!/bin/bash
 
 # Installation commands for java 8
+# distros: debian ubuntu
+# requires: apt-get
+# provides: java javac add-apt-repository wget
+# artifacts: /usr/lib/jvm /etc/alternatives /usr/bin/java /usr/bin/javac
+# verify: java -version
+# expect: version "1.8
 #[cite: https://linuxize.com/post/install-java-on-debian-10/]
-apt update -y
-apt install -y apt-transport-https
-apt install -y ca-certificates
-apt install -y wget dirmngr gnupg
-apt install -y software-properties-common
+set -e
+apt-get update -y
+apt-get install -y apt-transport-https
+apt-get install -y ca-certificates
+apt-get install -y wget dirmngr gnupg
+apt-get install -y software-properties-common
 # Fetching the key.
 wget -qO - https://adoptopenjdk.jfrog.io/adoptopenjdk/api/gpg/key/public | apt-key add -
 # Adding adoptopenjdk repository now that we have the key.
 add-apt-repository --yes https://adoptopenjdk.jfrog.io/adoptopenjdk/deb/
 # update sources and install java 8 jdk.
-apt update -y
-apt install -y adoptopenjdk-8-hotspot
\ No newline at end of file
+apt-get update -y
+apt-get install -y adoptopenjdk-8-hotspot
@@ -0,0 +1,17 @@
+#!/bin/bash
+
+# Installation commands for node 16
+# distros: debian ubuntu
+# requires: apt-get
+# provides: node npm curl
+# artifacts: /usr/local/bin /usr/local/lib/node_modules
+# verify: node --version
+# expect: v16.
+set -e
+apt-get update -y
+apt-get install -y curl ca-certificates xz-utils
+# The release is unpacked into /usr/local, where npm also installs the global packages.
+# The links of npm are copied along with the directories in a multi-stage build.
+curl -fsSL https://nodejs.org/dist/v16.20.2/node-v16.20.2-linux-x64.tar.xz |
+  tar -xJ -C /usr/local --strip-components=1 --no-same-owner \
+    node-v16.20.2-linux-x64/bin node-v16.20.2-linux-x64/lib
@@ -1,8 +1,16 @@
 #!/bin/bash
 
 # Installation commands for python 3.7
+# distros: debian ubuntu
+# requires: apt-get
+# provides: python python3.7 pip3
+# artifacts: /usr/bin/python3.7 /usr/lib/python3.7 /usr/local/bin/python
+# verify: python --version
+# expect: Python 3.7
+set -e
 apt-get update -y
 apt-get install python3.7 -y
-apt-get update -y
 apt-get install python3-pip -y
-alias python=python3
+# An alias has no effect beyond the shell running this script,
+# so `python` is linked to python 3.7 instead.
+ln -sf "$(command -v python3.7)" /usr/local/bin/python
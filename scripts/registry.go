@@ -0,0 +1,169 @@
+// Package scripts implements the registry of the language installation scripts,
+// which are embedded in the binary and can be overridden by the scripts of a directory.
+package scripts
+
+import (
+	"embed"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// scriptExt is the extension of the installation scripts.
+const scriptExt = ".sh"
+
+//go:embed *.sh
+var embeddedScripts embed.FS
+
+// Script struct type holds an installation script along with the language
+// and version it installs, and the description, supported distros, provided
+// binaries, required tools, runtime artifacts and packages and verification
+// given by its header comment.
+type Script struct {
+	Language    string
+	Version     string
+	Name        string
+	Description string
+	Distros     []string
+	Provides    []string
+	Requires    []string
+	Artifacts   []string
+	Packages    []string
+	Verify      string
+	Expect      string
+	Content     []byte
+	Overridden  bool
+}
+
+// Registry struct type holds the installation scripts keyed by their language and version.
+type Registry struct {
+	scripts map[string]Script
+}
+
+var (
+	defaultRegistryMutex sync.Mutex
+	defaultRegistry      *Registry
+)
+
+// NewRegistry creates a registry holding the embedded installation scripts.
+// The scripts of the override directory, if given, replace the embedded scripts
+// of the same language and version, or add to them.
+func NewRegistry(overrideDir string) (*Registry, error) {
+	registry := &Registry{scripts: make(map[string]Script)}
+	if err := registry.addScripts(embeddedScripts, false); err != nil {
+		return nil, errors.Wrap(err, "error in reading embedded installation scripts")
+	}
+	if overrideDir != "" {
+		if _, err := os.Stat(overrideDir); err != nil {
+			return nil, errors.Wrap(err, "error in reading installation scripts override directory")
+		}
+		if err := registry.addScripts(os.DirFS(overrideDir), true); err != nil {
+			return nil, errors.Wrapf(err, "error in reading installation scripts of %s", overrideDir)
+		}
+	}
+	return registry, nil
+}
+
+// Default returns the registry used to validate the languages and build the images,
+// which holds the embedded installation scripts unless overridden by UseOverrideDir.
+func Default() *Registry {
+	defaultRegistryMutex.Lock()
+	defer defaultRegistryMutex.Unlock()
+	if defaultRegistry == nil {
+		registry, err := NewRegistry("")
+		if err != nil {
+			// The embedded scripts are part of the binary, so reading them cannot fail.
+			panic(err)
+		}
+		defaultRegistry = registry
+	}
+	return defaultRegistry
+}
+
+// UseOverrideDir replaces the default registry with a registry whose
+// embedded installation scripts are overridden by the scripts of the directory.
+func UseOverrideDir(overrideDir string) error {
+	registry, err := NewRegistry(overrideDir)
+	if err != nil {
+		return err
+	}
+	defaultRegistryMutex.Lock()
+	defer defaultRegistryMutex.Unlock()
+	defaultRegistry = registry
+	return nil
+}
+
+// Get returns the installation script of the given language and version.
+func (registry *Registry) Get(language string, version string) (Script, bool) {
+	script, found := registry.scripts[GetScriptName(language, version)]
+	return script, found
+}
+
+// List returns all installation scripts, sorted by their language and version.
+func (registry *Registry) List() []Script {
+	var scripts []Script
+	for _, script := range registry.scripts {
+		scripts = append(scripts, script)
+	}
+	sort.Slice(scripts, func(i, j int) bool {
+		if scripts[i].Language != scripts[j].Language {
+			return scripts[i].Language < scripts[j].Language
+		}
+		return scripts[i].Version < scripts[j].Version
+	})
+	return scripts
+}
+
+// GetScriptName returns the file name of the installation script of the given language and version.
+func GetScriptName(language string, version string) string {
+	return fmt.Sprintf("%s_%s%s", language, version, scriptExt)
+}
+
+// addScripts adds the installation scripts at the root of the file system,
+// named as `<language>_<version>.sh`, to the registry.
+func (registry *Registry) addScripts(fileSystem fs.FS, overridden bool) error {
+	entries, err := fs.ReadDir(fileSystem, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != scriptExt {
+			continue
+		}
+		separator := strings.LastIndex(name, "_")
+		if separator <= 0 || separator == len(name)-len(scriptExt)-1 {
+			return errors.Errorf("installation script %s is not named as <language>_<version>%s", name, scriptExt)
+		}
+
+		content, err := fs.ReadFile(fileSystem, name)
+		if err != nil {
+			return err
+		}
+		scriptHeader, err := parseHeader(content)
+		if err != nil {
+			return errors.Wrapf(err, "error in parsing header of installation script %s", name)
+		}
+		registry.scripts[name] = Script{
+			Language:    name[:separator],
+			Version:     strings.TrimSuffix(name[separator+1:], scriptExt),
+			Name:        name,
+			Description: scriptHeader.description,
+			Distros:     scriptHeader.distros,
+			Provides:    scriptHeader.provides,
+			Requires:    scriptHeader.requires,
+			Artifacts:   scriptHeader.artifacts,
+			Packages:    scriptHeader.packages,
+			Verify:      scriptHeader.verify,
+			Expect:      scriptHeader.expect,
+			Content:     content,
+			Overridden:  overridden,
+		}
+	}
+	return nil
+}
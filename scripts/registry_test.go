@@ -0,0 +1,89 @@
+// Package scripts implements the registry of the language installation scripts,
+// which are embedded in the binary and can be overridden by the scripts of a directory.
+package scripts
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRegistry tests the embedded installation scripts and
+// their override by the scripts of a directory.
+func TestRegistry(t *testing.T) {
+	registry, err := NewRegistry("")
+	assert.NoError(t, err)
+	script, found := registry.Get("gcc", "7")
+	assert.True(t, found)
+	assert.Equal(t, "gcc_7.sh", script.Name)
+	assert.Equal(t, "Installation commands for gcc 7", script.Description)
+	assert.False(t, script.Overridden)
+	_, found = registry.Get("rust", "1.44")
+	assert.False(t, found)
+
+	overrideDir, err := ioutil.TempDir("", "scripts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(overrideDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(overrideDir, "gcc_7.sh"),
+		[]byte("#!/bin/bash\n\n# Custom gcc 7\napt-get install -y gcc-7\n"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(overrideDir, "rust_1.44.sh"),
+		[]byte("#!/bin/bash\ncurl https://sh.rustup.rs -sSf | sh -s -- -y\n"), 0755))
+
+	registry, err = NewRegistry(overrideDir)
+	assert.NoError(t, err)
+	script, found = registry.Get("gcc", "7")
+	assert.True(t, found)
+	assert.Equal(t, "Custom gcc 7", script.Description)
+	assert.True(t, script.Overridden)
+	script, found = registry.Get("rust", "1.44")
+	assert.True(t, found)
+	assert.Equal(t, "", script.Description)
+	assert.Len(t, registry.List(), 8)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(overrideDir, "rust.sh"), []byte("#!/bin/bash\n"), 0755))
+	_, err = NewRegistry(overrideDir)
+	assert.Error(t, err)
+	_, err = NewRegistry(filepath.Join(overrideDir, "missing"))
+	assert.Error(t, err)
+}
+
+// TestParseHeader tests parsing the metadata declared by the header comment of a script.
+func TestParseHeader(t *testing.T) {
+	registry, err := NewRegistry("")
+	assert.NoError(t, err)
+	script, found := registry.Get("gpp", "7")
+	assert.True(t, found)
+	assert.Equal(t, []string{"ubuntu"}, script.Distros)
+	assert.Equal(t, []string{"apt-get"}, script.Requires)
+	assert.Equal(t, []string{"g++-7", "add-apt-repository"}, script.Provides)
+	assert.Equal(t, []string{"/usr/bin/g++-7", "/usr/bin/x86_64-linux-gnu-g++-7", "/usr/bin/gcc-7",
+		"/usr/bin/x86_64-linux-gnu-gcc-7", "/usr/lib/gcc/x86_64-linux-gnu/7"}, script.Artifacts)
+	assert.Contains(t, script.Packages, "libstdc++-7-dev")
+	assert.True(t, script.RequiresApt())
+	assert.Equal(t, "g++-7 --version 2>&1 | grep -F g++-7", script.GetVerifyCommand())
+	assert.True(t, script.SupportsDistro("ubuntu"))
+	assert.False(t, script.SupportsDistro("debian"))
+
+	script, _ = registry.Get("java", "11")
+	assert.Equal(t, `java -version 2>&1 | grep -F 'version "11'`, script.GetVerifyCommand())
+
+	parsed, err := parseHeader([]byte("#!/bin/sh\n# verify: it's --version\n# note: not a field\n"))
+	assert.EqualError(t, err, "unknown header field note")
+	parsed, err = parseHeader([]byte("#!/bin/sh\n# Description\n# verify: tool --version\n\n# distros: alpine\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, header{description: "Description", verify: "tool --version"}, parsed)
+
+	invalidHeaders := map[string]string{
+		"#!/bin/sh\n# Description\n# distros: arch\n":                            "unknown distro arch, known distros are alpine, debian, ubuntu",
+		"#!/bin/sh\n# Description\n# expect: 1.0\n":                              "expected output declared without a verify command",
+		"#!/bin/sh\n# Description\n# artifacts: lib\n":                           "artifact lib is not an absolute path",
+		"#!/bin/sh\n# Description\n# packages: binutils\n":                       "runtime packages declared without requiring apt-get",
+		"#!/bin/sh\n# Description\n# requires: apt-get\n# packages: bin;utils\n": "invalid runtime package bin;utils",
+	}
+	for content, expectedErr := range invalidHeaders {
+		_, err = parseHeader([]byte(content))
+		assert.EqualError(t, err, expectedErr)
+	}
+}
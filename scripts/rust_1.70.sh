@@ -0,0 +1,19 @@
+#!/bin/bash
+
+# Installation commands for rust 1.70
+# distros: debian ubuntu
+# requires: apt-get
+# provides: rustc cargo curl cc
+# artifacts: /usr/local/bin/rustc /usr/local/bin/cargo /usr/local/lib/rustlib /usr/local/lib/librustc_driver-*.so /usr/local/lib/libstd-*.so
+# packages: gcc libc6-dev
+# verify: rustc --version
+# expect: rustc 1.70
+set -e
+apt-get update -y
+# cargo links the crates with the C compiler.
+apt-get install -y curl ca-certificates gcc libc6-dev
+# The standalone installer puts the toolchain into /usr/local, so that no environment variables are needed.
+curl -fsSL https://static.rust-lang.org/dist/rust-1.70.0-x86_64-unknown-linux-gnu.tar.gz | tar -xz -C /tmp
+/tmp/rust-1.70.0-x86_64-unknown-linux-gnu/install.sh --prefix=/usr/local \
+  --components=rustc,cargo,rust-std-x86_64-unknown-linux-gnu
+rm -rf /tmp/rust-1.70.0-x86_64-unknown-linux-gnu
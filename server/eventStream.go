@@ -0,0 +1,136 @@
+// Package server implements routines to serve the image builder over a REST API,
+// which accepts assignment environment configurations and builds their images
+// as jobs run by a bounded pool of workers.
+package server
+
+import (
+	"assignment-exec/image-builder/builder"
+	"encoding/json"
+	"sync"
+)
+
+const (
+	// replayBufferSize is the number of latest events of a job replayed to a late subscriber.
+	replayBufferSize = 1024
+	// subscriberBufferSize is the number of events that a subscriber can lag behind
+	// before it is dropped, so that a slow subscriber never blocks the build.
+	subscriberBufferSize = 256
+)
+
+// Event names of the events streamed for a job.
+const (
+	// StatusEventName is the name of the event carrying the job once it starts running.
+	StatusEventName = "status"
+	// ProgressEventName is the name of the event carrying a decoded build, push or pull progress event.
+	ProgressEventName = "progress"
+	// DoneEventName is the name of the terminal event carrying the finished job,
+	// i.e its image digest or the error that failed it.
+	DoneEventName = "done"
+)
+
+// streamEvent struct type holds an event of a job, numbered in the order of publishing,
+// with its name and JSON encoded data.
+type streamEvent struct {
+	ID   int
+	Name string
+	Data []byte
+}
+
+// eventBroadcaster struct type holds the latest events of a job for replay and the channels
+// of the subscribers, to which every published event is fanned out.
+type eventBroadcaster struct {
+	mutex       sync.Mutex
+	nextID      int
+	history     []streamEvent
+	subscribers map[chan streamEvent]struct{}
+	closed      bool
+}
+
+// newEventBroadcaster creates and returns a new instance of eventBroadcaster.
+func newEventBroadcaster() *eventBroadcaster {
+	return &eventBroadcaster{nextID: 1, subscribers: make(map[chan streamEvent]struct{})}
+}
+
+// publish encodes the value as the data of an event with the given name and fans it out
+// to the subscribers. Subscribers that lag too far behind are dropped.
+// Events published after the terminal event are discarded.
+func (broadcaster *eventBroadcaster) publish(name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	broadcaster.mutex.Lock()
+	defer broadcaster.mutex.Unlock()
+	if broadcaster.closed {
+		return nil
+	}
+	event := streamEvent{ID: broadcaster.nextID, Name: name, Data: data}
+	broadcaster.nextID++
+
+	broadcaster.history = append(broadcaster.history, event)
+	if len(broadcaster.history) > replayBufferSize {
+		broadcaster.history = broadcaster.history[len(broadcaster.history)-replayBufferSize:]
+	}
+	for subscriber := range broadcaster.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(broadcaster.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	if name == DoneEventName {
+		broadcaster.closed = true
+		for subscriber := range broadcaster.subscribers {
+			close(subscriber)
+		}
+		broadcaster.subscribers = nil
+	}
+	return nil
+}
+
+// subscribe returns the buffered events following the event with the given ID, and the
+// channel receiving the events published afterwards, which is closed after the terminal
+// event. The returned function unsubscribes the channel.
+func (broadcaster *eventBroadcaster) subscribe(lastEventID int) ([]streamEvent, <-chan streamEvent, func()) {
+	broadcaster.mutex.Lock()
+	defer broadcaster.mutex.Unlock()
+
+	var replay []streamEvent
+	for _, event := range broadcaster.history {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+
+	subscriber := make(chan streamEvent, subscriberBufferSize)
+	if broadcaster.closed {
+		close(subscriber)
+		return replay, subscriber, func() {}
+	}
+	broadcaster.subscribers[subscriber] = struct{}{}
+	return replay, subscriber, func() {
+		broadcaster.mutex.Lock()
+		defer broadcaster.mutex.Unlock()
+		if _, found := broadcaster.subscribers[subscriber]; found {
+			delete(broadcaster.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// jobRenderer struct type holds the renderer writing the progress of a job to its log,
+// and the broadcaster fanning the progress events out to the subscribers of the job.
+type jobRenderer struct {
+	log    builder.ProgressRenderer
+	events *eventBroadcaster
+}
+
+// Render publishes the progress event to the subscribers and writes it to the log.
+func (renderer *jobRenderer) Render(event builder.ProgressEvent) error {
+	if err := renderer.events.publish(ProgressEventName, event); err != nil {
+		return err
+	}
+	return renderer.log.Render(event)
+}
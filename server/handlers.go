@@ -0,0 +1,183 @@
+// Package server implements routines to serve the image builder over a REST API,
+// which accepts assignment environment configurations and builds their images
+// as jobs run by a bounded pool of workers.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxConfigSize is the maximum size in bytes of a submitted configuration.
+const maxConfigSize = 1 << 20
+
+// Handler returns the http handler of the REST API, which serves the following routes.
+//
+//	POST /jobs[?publish=true]  submits the assignment environment configuration yaml in the body.
+//	GET  /jobs                 lists the jobs.
+//	GET  /jobs/{id}            returns the status of a job.
+//	GET  /jobs/{id}/logs       returns the log of a job as plain text.
+//	GET  /jobs/{id}/events     streams the events of a job as server-sent events.
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", server.handleJobs)
+	mux.HandleFunc("/jobs/", server.handleJob)
+	return mux
+}
+
+// handleJobs submits a job or lists the jobs.
+func (server *Server) handleJobs(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		writeJSON(writer, http.StatusOK, server.GetJobs())
+	case http.MethodPost:
+		server.handleSubmit(writer, request)
+	default:
+		writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleSubmit submits the configuration in the request body as a job. It responds with
+// 202 Accepted for a new job, or with 200 OK for the job already building the configuration.
+func (server *Server) handleSubmit(writer http.ResponseWriter, request *http.Request) {
+	publish := false
+	if value := request.URL.Query().Get("publish"); value != "" {
+		var err error
+		if publish, err = strconv.ParseBool(value); err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid value of publish: "+value)
+			return
+		}
+	}
+
+	config, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maxConfigSize))
+	if err != nil {
+		writeError(writer, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	job, created, err := server.Submit(config, publish)
+	switch {
+	case err == ErrQueueFull:
+		writeError(writer, http.StatusServiceUnavailable, err.Error())
+	case err == ErrAssetsNotSupported:
+		writeError(writer, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case created:
+		writer.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(writer, http.StatusAccepted, job)
+	default:
+		writer.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(writer, http.StatusOK, job)
+	}
+}
+
+// handleJob returns the status or the log of a job.
+func (server *Server) handleJob(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(request.URL.Path, "/jobs/"), "/")
+	switch {
+	case len(path) == 1:
+		job, found := server.GetJob(path[0])
+		if !found {
+			writeError(writer, http.StatusNotFound, "job not found")
+			return
+		}
+		writeJSON(writer, http.StatusOK, job)
+	case len(path) == 2 && path[1] == "logs":
+		jobLog, found := server.GetJobLog(path[0])
+		if !found {
+			writeError(writer, http.StatusNotFound, "job not found")
+			return
+		}
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := writer.Write(jobLog); err != nil {
+			log.Printf("error in writing log of job %s: %v", path[0], err)
+		}
+	case len(path) == 2 && path[1] == "events":
+		server.handleEvents(writer, request, path[0])
+	default:
+		writeError(writer, http.StatusNotFound, "not found")
+	}
+}
+
+// handleEvents streams the events of the job as server-sent events, starting with the
+// buffered events following the one given by the Last-Event-ID header, if any.
+// The stream ends after the terminal event of the job.
+func (server *Server) handleEvents(writer http.ResponseWriter, request *http.Request, id string) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	lastEventID := 0
+	if value := request.Header.Get("Last-Event-ID"); value != "" {
+		var err error
+		if lastEventID, err = strconv.Atoi(value); err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid Last-Event-ID: "+value)
+			return
+		}
+	}
+
+	replay, events, unsubscribe, found := server.GetJobEvents(id, lastEventID)
+	if !found {
+		writeError(writer, http.StatusNotFound, "job not found")
+		return
+	}
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	for _, event := range replay {
+		if err := writeEvent(writer, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			if err := writeEvent(writer, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes the event in the server-sent events format.
+func writeEvent(writer io.Writer, event streamEvent) error {
+	_, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Name, event.Data)
+	return err
+}
+
+// writeJSON writes the value as the JSON response with the given status code.
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.Printf("error in writing response: %v", err)
+	}
+}
+
+// writeError writes the error message as the JSON response with the given status code.
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, map[string]string{"error": message})
+}
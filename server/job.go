@@ -0,0 +1,67 @@
+// Package server implements routines to serve the image builder over a REST API,
+// which accepts assignment environment configurations and builds their images
+// as jobs run by a bounded pool of workers.
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// JobStatus represents the state of a build job.
+type JobStatus string
+
+const (
+	// JobQueued is the status of a job waiting for a worker.
+	JobQueued JobStatus = "queued"
+	// JobRunning is the status of a job being built by a worker.
+	JobRunning JobStatus = "running"
+	// JobSucceeded is the status of a job whose image has been built, and published if requested.
+	JobSucceeded JobStatus = "succeeded"
+	// JobFailed is the status of a job whose build failed and has been undone.
+	JobFailed JobStatus = "failed"
+)
+
+// Job struct type holds the details of a build job as reported by the API,
+// i.e its status, the digest of its configuration, the resulting image and
+// the error that failed the job, if any.
+type Job struct {
+	ID           string     `json:"id"`
+	Status       JobStatus  `json:"status"`
+	ConfigDigest string     `json:"configDigest"`
+	Publish      bool       `json:"publish"`
+	Image        string     `json:"image,omitempty"`
+	ImageID      string     `json:"imageId,omitempty"`
+	ImageDigest  string     `json:"imageDigest,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+
+	key    string
+	config []byte
+	log    *jobLog
+	events *eventBroadcaster
+}
+
+// jobLog struct type holds the log of a job, which is written
+// by its worker while being read by the API.
+type jobLog struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+// Write appends the data to the log.
+func (log *jobLog) Write(data []byte) (int, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return log.buffer.Write(data)
+}
+
+// Bytes returns a copy of the log written so far.
+func (log *jobLog) Bytes() []byte {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return append([]byte(nil), log.buffer.Bytes()...)
+}
@@ -0,0 +1,373 @@
+// Package server implements routines to serve the image builder over a REST API,
+// which accepts assignment environment configurations and builds their images
+// as jobs run by a bounded pool of workers.
+package server
+
+import (
+	"assignment-exec/image-builder/builder"
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/history"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned when a job is submitted while the queue of jobs is full.
+var ErrQueueFull = errors.New("build queue is full")
+
+// ErrAssetsNotSupported is returned when a configuration with assets is submitted. Only the
+// configuration is uploaded, so the files of the assets are not available to the build.
+var ErrAssetsNotSupported = errors.New("configurations with assets are not supported by the server, " +
+	"as only the configuration is uploaded")
+
+// Server struct type holds the container engine used to build the images,
+// the jobs by their ID and by their configuration, and the queue of jobs
+// waiting for one of the workers.
+type Server struct {
+	engine    containers.ContainerEngine
+	workers   int
+	queueSize int
+	workDir   string
+	timeouts  configurations.PhaseTimeouts
+	history   *history.Store
+	queue     chan *Job
+	mutex     sync.Mutex
+	jobs      map[string]*Job
+	jobsByKey map[string]*Job
+}
+
+// ServerOption represents options that can be used to help initialize
+// an instance of Server.
+// Each option is a closure that is responsible for initializing one or more members
+// while instantiating Server.
+type ServerOption func(*Server) error
+
+// NewServer constructs an instance of Server
+// by applying each of the provided options.
+// The construction of the object fails upon the failure of at least one of the given options.
+func NewServer(options ...ServerOption) (*Server, error) {
+	server := &Server{
+		workers:   1,
+		queueSize: 16,
+		workDir:   os.TempDir(),
+		jobs:      make(map[string]*Job),
+		jobsByKey: make(map[string]*Job),
+	}
+	for _, opt := range options {
+		if err := opt(server); err != nil {
+			return nil, errors.Wrap(err, "failed to create server instance")
+		}
+	}
+
+	// Use the docker engine if no other container engine has been provided.
+	if server.engine == nil {
+		engine, err := builder.NewDockerEngine()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create server instance")
+		}
+		server.engine = engine
+	}
+	server.queue = make(chan *Job, server.queueSize)
+	return server, nil
+}
+
+// WithContainerEngine returns a ServerOption for initializing
+// the container engine used to build and publish the images.
+func WithContainerEngine(engine containers.ContainerEngine) ServerOption {
+	return func(server *Server) error {
+		if engine == nil {
+			return errors.New("container engine not provided")
+		}
+		server.engine = engine
+		return nil
+	}
+}
+
+// WithHistoryStore returns a ServerOption for initializing the store
+// in which the build of every job is recorded.
+func WithHistoryStore(store *history.Store) ServerOption {
+	return func(server *Server) error {
+		if store == nil {
+			return errors.New("history store not provided")
+		}
+		server.history = store
+		return nil
+	}
+}
+
+// WithWorkers returns a ServerOption for initializing the number
+// of jobs that are built concurrently.
+func WithWorkers(workers int) ServerOption {
+	return func(server *Server) error {
+		if workers < 1 {
+			return errors.New("at least one worker is required")
+		}
+		server.workers = workers
+		return nil
+	}
+}
+
+// WithQueueSize returns a ServerOption for initializing the number
+// of jobs that can wait for a worker.
+func WithQueueSize(queueSize int) ServerOption {
+	return func(server *Server) error {
+		if queueSize < 1 {
+			return errors.New("queue size must be positive")
+		}
+		server.queueSize = queueSize
+		return nil
+	}
+}
+
+// WithWorkDir returns a ServerOption for initializing the directory
+// holding the configuration and Dockerfile of the running jobs.
+func WithWorkDir(workDir string) ServerOption {
+	return func(server *Server) error {
+		if workDir == "" {
+			return errors.New("work directory not provided")
+		}
+		server.workDir = workDir
+		return nil
+	}
+}
+
+// WithPhaseTimeouts returns a ServerOption for initializing the timeouts of the
+// verify, build and publish phases of every job, which take precedence over the
+// timeouts in the submitted configurations.
+func WithPhaseTimeouts(timeouts configurations.PhaseTimeouts) ServerOption {
+	return func(server *Server) error {
+		server.timeouts = timeouts
+		return nil
+	}
+}
+
+// Start starts the workers, which build the queued jobs until the context is done.
+// The running builds are cancelled and undone once the context is done.
+func (server *Server) Start(ctx context.Context) {
+	for i := 0; i < server.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-server.queue:
+					server.runJob(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// Submit validates the configuration and enqueues a job to build its image, publishing it
+// if requested. If a job for the same configuration is queued, running or has succeeded,
+// then that job is returned instead and the returned flag is false.
+// A configuration with assets is refused, as the files of its assets are not uploaded.
+func (server *Server) Submit(config []byte, publish bool) (Job, bool, error) {
+	asgmtEnvConfig := &configurations.AssignmentEnvConfig{}
+	if err := yaml.Unmarshal(config, asgmtEnvConfig); err != nil {
+		return Job{}, false, errors.Wrap(err, "invalid configuration")
+	}
+	if len(asgmtEnvConfig.Assets) > 0 {
+		return Job{}, false, ErrAssetsNotSupported
+	}
+	digest, err := asgmtEnvConfig.GetDigest()
+	if err != nil {
+		return Job{}, false, err
+	}
+	key := fmt.Sprintf("%s %s %t", digest, asgmtEnvConfig.Registry, publish)
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if existing, found := server.jobsByKey[key]; found && existing.Status != JobFailed {
+		return *existing, false, nil
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, false, err
+	}
+	job := &Job{
+		ID:           id,
+		Status:       JobQueued,
+		ConfigDigest: digest,
+		Publish:      publish,
+		CreatedAt:    time.Now().UTC(),
+		key:          key,
+		config:       config,
+		log:          &jobLog{},
+		events:       newEventBroadcaster(),
+	}
+	select {
+	case server.queue <- job:
+	default:
+		return Job{}, false, ErrQueueFull
+	}
+	server.jobs[id] = job
+	server.jobsByKey[key] = job
+	return *job, true, nil
+}
+
+// GetJob returns the job with the given ID.
+func (server *Server) GetJob(id string) (Job, bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	job, found := server.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// GetJobs returns all jobs in the order of their creation.
+func (server *Server) GetJobs() []Job {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	jobs := []Job{}
+	for _, job := range server.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// GetJobLog returns the log of the job with the given ID.
+func (server *Server) GetJobLog(id string) ([]byte, bool) {
+	server.mutex.Lock()
+	job, found := server.jobs[id]
+	server.mutex.Unlock()
+	if !found {
+		return nil, false
+	}
+	return job.log.Bytes(), true
+}
+
+// GetJobEvents returns the buffered events of the job with the given ID following the
+// event with the given ID, the channel receiving its later events and the function to
+// unsubscribe the channel.
+func (server *Server) GetJobEvents(id string, lastEventID int) ([]streamEvent, <-chan streamEvent, func(), bool) {
+	server.mutex.Lock()
+	job, found := server.jobs[id]
+	server.mutex.Unlock()
+	if !found {
+		return nil, nil, nil, false
+	}
+	replay, events, unsubscribe := job.events.subscribe(lastEventID)
+	return replay, events, unsubscribe, true
+}
+
+// runJob builds the image of the job through a BuildManager and records its outcome,
+// which is published to the subscribers of the job as its terminal event.
+func (server *Server) runJob(ctx context.Context, job *Job) {
+	server.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.Status = JobRunning
+		job.StartedAt = &now
+	})
+	server.publishJob(job, StatusEventName)
+
+	err := server.buildJob(ctx, job)
+	if err != nil {
+		fmt.Fprintf(job.log, "error: %v\n", err)
+	}
+
+	server.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.Status = JobSucceeded
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		}
+	})
+	server.publishJob(job, DoneEventName)
+}
+
+// publishJob publishes the current state of the job as the event with the given name.
+func (server *Server) publishJob(job *Job, name string) {
+	server.mutex.Lock()
+	snapshot := *job
+	server.mutex.Unlock()
+	if err := job.events.publish(name, snapshot); err != nil {
+		fmt.Fprintf(job.log, "error in publishing %s event: %v\n", name, err)
+	}
+}
+
+// buildJob writes the configuration of the job to a private directory and executes
+// the commands to verify, build and publish its image, recording the resulting image
+// in the job. It returns any error encountered while building the image.
+func (server *Server) buildJob(ctx context.Context, job *Job) error {
+	jobDir, err := ioutil.TempDir(server.workDir, "job-"+job.ID+"-")
+	if err != nil {
+		return errors.Wrap(err, "error in creating job directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(jobDir); err != nil {
+			fmt.Fprintf(job.log, "error in removing job directory: %v\n", err)
+		}
+	}()
+
+	configFile := filepath.Join(jobDir, "assignment-env.yaml")
+	if err := ioutil.WriteFile(configFile, job.config, 0600); err != nil {
+		return errors.Wrap(err, "error in writing configuration")
+	}
+
+	logRenderer, err := builder.NewProgressRenderer(builder.PlainProgress, job.log)
+	if err != nil {
+		return err
+	}
+	renderer := &jobRenderer{log: logRenderer, events: job.events}
+	asgmtEnv, err := builder.GetConfigurations(job.Publish, "", configFile, filepath.Join(jobDir, "Dockerfile"),
+		builder.WithContainerEngine(server.engine),
+		builder.WithProgressRenderer(renderer),
+		builder.WithPhaseTimeouts(server.timeouts))
+	if err != nil {
+		return err
+	}
+	buildManagerOptions := []builder.BuildManagerOption{builder.WithCommands(asgmtEnv, ioutil.Discard)}
+	if server.history != nil {
+		buildManagerOptions = append(buildManagerOptions, builder.WithHistory(server.history))
+	}
+	buildManager, err := builder.NewBuildManager(buildManagerOptions...)
+	if err != nil {
+		return err
+	}
+	err = buildManager.ExecuteCommands(ctx)
+
+	server.updateJob(job, func() {
+		job.Image = asgmtEnv.GetImageReference()
+		job.ImageID = asgmtEnv.ImageID
+		job.ImageDigest = asgmtEnv.ImageDigest
+	})
+	return err
+}
+
+// updateJob applies the update to the job while holding the lock of the server.
+func (server *Server) updateJob(job *Job, update func()) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	update()
+}
+
+// newJobID returns a new random job ID.
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.Wrap(err, "error in generating job ID")
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,228 @@
+// Package server implements routines to serve the image builder over a REST API,
+// which accepts assignment environment configurations and builds their images
+// as jobs run by a bounded pool of workers.
+package server
+
+import (
+	"assignment-exec/image-builder/builder"
+	"assignment-exec/image-builder/builder/containers"
+	"assignment-exec/image-builder/builder/fake"
+	"assignment-exec/image-builder/environment"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupServer changes to the repository root, sets the docker authentication environment
+// variables and starts a server backed by a fake engine whose registry holds the code-runner
+// base image. It returns the server, the API and the configuration to submit.
+func setupServer(t *testing.T) (*Server, *httptest.Server, string, func()) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(".."))
+	assert.NoError(t, os.Setenv(environment.DockerAuthUsername, "assignmentexec"))
+	assert.NoError(t, os.Setenv(environment.DockerAuthPassword, "password"))
+
+	engine := fake.NewEngine()
+	engine.RemoteImages["assignmentexec/code-runner:1.0"] = &containers.ImageInfo{ID: "sha256:code-runner"}
+	registry := httptest.NewServer(engine.RegistryHandler())
+	registryHost := registry.Listener.Addr().String()
+	config := fmt.Sprintf("baseImage: %s/assignmentexec/code-runner:1.0\nregistry: %s\n"+
+		"dependencies:\n  lang: gcc\n  langVersion: 7\n", registryHost, registryHost)
+
+	server, err := NewServer(WithContainerEngine(engine), WithWorkers(2), WithQueueSize(4))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	server.Start(ctx)
+	api := httptest.NewServer(server.Handler())
+
+	return server, api, config, func() {
+		api.Close()
+		cancel()
+		registry.Close()
+		assert.NoError(t, os.Chdir(workDir))
+	}
+}
+
+// submit posts the configuration to the API and decodes the returned job.
+func submit(t *testing.T, api *httptest.Server, config string, query string) (Job, int) {
+	response, err := http.Post(api.URL+"/jobs"+query, "application/yaml", strings.NewReader(config))
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	job := Job{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+	return job, response.StatusCode
+}
+
+// waitForJob polls the API until the job is done.
+func waitForJob(t *testing.T, api *httptest.Server, id string) Job {
+	job := Job{}
+	for i := 0; i < 100; i++ {
+		response, err := http.Get(api.URL + "/jobs/" + id)
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+		response.Body.Close()
+		if job.Status == JobSucceeded || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s not done, status %s", id, job.Status)
+	return job
+}
+
+// TestSubmitJob tests that a submitted configuration is built and published,
+// and that the job status and logs are reported.
+func TestSubmitJob(t *testing.T) {
+	_, api, config, cleanup := setupServer(t)
+	defer cleanup()
+
+	job, status := submit(t, api, config, "?publish=true")
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.NotEmpty(t, job.ID)
+
+	job = waitForJob(t, api, job.ID)
+	assert.Equal(t, JobSucceeded, job.Status, job.Error)
+	assert.Contains(t, job.Image, "/assignmentexec/gcc7-")
+	assert.NotEmpty(t, job.ImageDigest)
+
+	response, err := http.Get(api.URL + "/jobs/" + job.ID + "/logs")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	logs, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(logs), "Successfully built")
+}
+
+// TestSubmitJobDeduplicated tests that a configuration that is already
+// building or built is not built again.
+func TestSubmitJobDeduplicated(t *testing.T) {
+	server, api, config, cleanup := setupServer(t)
+	defer cleanup()
+
+	first, status := submit(t, api, config, "")
+	assert.Equal(t, http.StatusAccepted, status)
+	second, status := submit(t, api, config, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, first.ID, second.ID)
+
+	waitForJob(t, api, first.ID)
+	third, status := submit(t, api, config, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, first.ID, third.ID)
+
+	published, status := submit(t, api, config, "?publish=true")
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.NotEqual(t, first.ID, published.ID)
+	assert.Len(t, server.GetJobs(), 2)
+}
+
+// TestSubmitInvalidConfig tests that an invalid configuration is refused.
+func TestSubmitInvalidConfig(t *testing.T) {
+	server, api, _, cleanup := setupServer(t)
+	defer cleanup()
+
+	response, err := http.Post(api.URL+"/jobs", "application/yaml", strings.NewReader("baseImage: \"\"\n"))
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// The files of the assets are not uploaded along with the configuration.
+	response, err = http.Post(api.URL+"/jobs", "application/yaml", strings.NewReader(
+		"baseImage: assignmentexec/code-runner:1.0\ndependencies:\n  lang: gcc\n  langVersion: 7\n"+
+			"assets:\n  - source: server.go\n    destination: /home/runner/\n"))
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Empty(t, server.GetJobs())
+
+	response, err = http.Get(api.URL + "/jobs/unknown")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+// readEvents reads the server-sent events of the job until the stream ends
+// and returns the names and data of the events.
+func readEvents(t *testing.T, api *httptest.Server, id string, lastEventID string) ([]string, []string) {
+	request, err := http.NewRequest(http.MethodGet, api.URL+"/jobs/"+id+"/events", nil)
+	assert.NoError(t, err)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+	var names, data []string
+	for _, event := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		for _, line := range strings.Split(event, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				names = append(names, strings.TrimPrefix(line, "event: "))
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+	return names, data
+}
+
+// TestJobEvents tests that the events of a job are replayed to a late subscriber
+// and that the stream ends with the terminal event carrying the image digest.
+func TestJobEvents(t *testing.T) {
+	_, api, config, cleanup := setupServer(t)
+	defer cleanup()
+
+	job, _ := submit(t, api, config, "?publish=true")
+	names, data := readEvents(t, api, job.ID, "")
+	assert.Equal(t, StatusEventName, names[0])
+	assert.Contains(t, names, ProgressEventName)
+	assert.Equal(t, DoneEventName, names[len(names)-1])
+
+	done := Job{}
+	assert.NoError(t, json.Unmarshal([]byte(data[len(data)-1]), &done))
+	assert.Equal(t, JobSucceeded, done.Status)
+	assert.Equal(t, waitForJob(t, api, job.ID).ImageDigest, done.ImageDigest)
+
+	names, _ = readEvents(t, api, job.ID, fmt.Sprint(len(names)-1))
+	assert.Equal(t, []string{DoneEventName}, names)
+}
+
+// TestEventBroadcaster tests that the events are fanned out to every subscriber
+// and that the subscriptions end after the terminal event.
+func TestEventBroadcaster(t *testing.T) {
+	broadcaster := newEventBroadcaster()
+	_, first, _ := broadcaster.subscribe(0)
+	_, second, unsubscribe := broadcaster.subscribe(0)
+	unsubscribe()
+
+	assert.NoError(t, broadcaster.publish(ProgressEventName, builder.ProgressEvent{Phase: "build"}))
+	assert.NoError(t, broadcaster.publish(DoneEventName, Job{Status: JobFailed, Error: "build failed"}))
+	assert.NoError(t, broadcaster.publish(ProgressEventName, builder.ProgressEvent{Phase: "build"}))
+
+	var names []string
+	for event := range first {
+		names = append(names, event.Name)
+	}
+	assert.Equal(t, []string{ProgressEventName, DoneEventName}, names)
+	_, open := <-second
+	assert.False(t, open)
+
+	replay, late, _ := broadcaster.subscribe(1)
+	assert.Len(t, replay, 1)
+	assert.Contains(t, string(replay[0].Data), "build failed")
+	_, open = <-late
+	assert.False(t, open)
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"assignment-exec/image-builder/builder"
+	"assignment-exec/image-builder/catalog"
+	"assignment-exec/image-builder/configurations"
+	"assignment-exec/image-builder/history"
+	"assignment-exec/image-builder/scripts"
+	"assignment-exec/image-builder/server"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// subcommand struct type holds the name and description of a subcommand
+// and the function that runs it with the remaining command line arguments.
+type subcommand struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+// subcommands lists the subcommands in the order they are shown in the usage.
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"validate", "Validate the configuration and verify the base image and language image", runValidate},
+		{"update", "Resolve the base image and language image again and refresh the lock file", runUpdate},
+		{"render", "Print the Dockerfile to stdout without building it", runRender},
+		{"build", "Build the image without publishing it", runBuild},
+		{"publish", "Publish an existing local image to the registry", runPublish},
+		{"inspect", "Show the resolved image tag, labels and digest", runInspect},
+		{"clean", "Remove the local images created by the image builder", runClean},
+		{"matrix", "Build the image of every variant expanded from the matrix of the configuration", runMatrix},
+		{"catalog", "Build the images of every assignment of a course catalog and write its lock file", runCatalog},
+		{"serve", "Serve a REST API that builds the submitted configurations as jobs", runServe},
+		{"history", "List the past builds, or show the details of one of them", runHistory},
+		{"languages", "List the supported languages and versions", runLanguages},
+	}
+}
+
+// runSubcommand runs the subcommand with the given name, which stops once the context is done.
+func runSubcommand(ctx context.Context, name string, args []string) error {
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			return cmd.run(ctx, args)
+		}
+	}
+	usage()
+	return fmt.Errorf("unknown subcommand %q", name)
+}
+
+// configFlags struct type holds the values of the flags
+// common to all subcommands that work on a configuration.
+type configFlags struct {
+	configFilepath *string
+	dockerfileLoc  *string
+	registry       *string
+	progress       *string
+	plan           *planFlags
+	timeouts       *timeoutFlags
+	scriptsDir     *string
+	verbose        *bool
+}
+
+// planFlags struct type holds the values of the flags that
+// request the plan of a subcommand instead of executing it.
+type planFlags struct {
+	enabled *bool
+	format  *string
+}
+
+// addPlanFlags adds the flags that request a plan to the flag set.
+func addPlanFlags(flagSet *flag.FlagSet) *planFlags {
+	return &planFlags{
+		enabled: flagSet.Bool("plan", false, "Only report what would be done, without doing it"),
+		format:  flagSet.String("planFormat", "text", "Format of the plan (text or json)"),
+	}
+}
+
+// timeoutFlags struct type holds the values of the flags that
+// set the timeouts of the verify, build and publish phases.
+type timeoutFlags struct {
+	verify  *time.Duration
+	build   *time.Duration
+	publish *time.Duration
+}
+
+// addTimeoutFlags adds the flags that set the phase timeouts to the flag set.
+func addTimeoutFlags(flagSet *flag.FlagSet) *timeoutFlags {
+	return &timeoutFlags{
+		verify:  flagSet.Duration("verifyTimeout", 0, "Timeout of the verify phase (overrides the config, 0 for none)"),
+		build:   flagSet.Duration("buildTimeout", 0, "Timeout of the build phase (overrides the config, 0 for none)"),
+		publish: flagSet.Duration("publishTimeout", 0, "Timeout of the publish phase (overrides the config, 0 for none)"),
+	}
+}
+
+// get returns the phase timeouts given by the flags.
+func (flags *timeoutFlags) get() configurations.PhaseTimeouts {
+	return configurations.PhaseTimeouts{
+		Verify:  *flags.verify,
+		Build:   *flags.build,
+		Publish: *flags.publish,
+	}
+}
+
+// newConfigFlagSet creates the flag set of a subcommand with the flags
+// required to read the configuration and build the image.
+func newConfigFlagSet(name string) (*flag.FlagSet, *configFlags) {
+	flagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	flags := &configFlags{
+		configFilepath: flagSet.String("assignmentEnvConfigFilepath", "assignment-env.yaml", "Assignment Environment configuration filepath"),
+		dockerfileLoc:  flagSet.String("dockerfileLoc", "Dockerfile", "Location for dockerfile to be created"),
+		registry:       flagSet.String("registry", "", "Registry to verify and publish images against (overrides the config, defaults to docker.io)"),
+		progress:       flagSet.String("progress", builder.AutoProgress, "Progress output format (auto, plain, tty or json)"),
+		plan:           addPlanFlags(flagSet),
+		timeouts:       addTimeoutFlags(flagSet),
+		scriptsDir:     addScriptsDirFlag(flagSet),
+		verbose:        addVerboseFlag(flagSet),
+	}
+	return flagSet, flags
+}
+
+// parse parses the arguments of the subcommand and overrides the
+// installation scripts with those of the scripts directory, if given.
+func (flags *configFlags) parse(flagSet *flag.FlagSet, args []string) error {
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	return useScriptsDir(*flags.scriptsDir)
+}
+
+// addScriptsDirFlag adds the flag that sets the directory overriding the installation scripts.
+func addScriptsDirFlag(flagSet *flag.FlagSet) *string {
+	return flagSet.String("scriptsDir", "",
+		"Directory of installation scripts (<lang>_<version>.sh) overriding or adding to the embedded scripts")
+}
+
+// addVerboseFlag adds the flag that requests the details of the build, e.g the manifest of the build context.
+func addVerboseFlag(flagSet *flag.FlagSet) *bool {
+	return flagSet.Bool("verbose", false, "Print the details of the build, e.g the files of the build context")
+}
+
+// useScriptsDir overrides the embedded installation scripts with those of the directory, if given.
+func useScriptsDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	return scripts.UseOverrideDir(dir)
+}
+
+// newProgressRenderer creates the progress renderer for the progress flag.
+// Progress is written to stderr so that the output of the subcommand can be piped.
+func (flags *configFlags) newProgressRenderer() (builder.ProgressRenderer, error) {
+	return builder.NewProgressRenderer(*flags.progress, os.Stderr)
+}
+
+// execute creates a build manager with the given option and executes its commands,
+// recording the execution in the history, or writes the plan of its commands to stdout
+// if requested. The commands stop once the context is done.
+func execute(ctx context.Context, option builder.BuildManagerOption, plan *planFlags) error {
+	if !*plan.enabled {
+		store, err := openHistoryStore()
+		if err != nil {
+			return err
+		}
+		buildManager, err := builder.NewBuildManager(option, builder.WithHistory(store))
+		if err != nil {
+			return err
+		}
+		return buildManager.ExecuteCommands(ctx)
+	}
+
+	buildManager, err := builder.NewBuildManager(option)
+	if err != nil {
+		return err
+	}
+
+	commandsPlan, err := buildManager.PlanCommands(ctx)
+	if err != nil {
+		return err
+	}
+	switch *plan.format {
+	case "text":
+		return commandsPlan.WriteText(os.Stdout)
+	case "json":
+		return commandsPlan.WriteJSON(os.Stdout)
+	}
+	return fmt.Errorf("unsupported plan format %q", *plan.format)
+}
+
+// runValidate validates the configuration and verifies the images it refers to.
+func runValidate(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("validate")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(false, *flags.registry, *flags.configFilepath, *flags.dockerfileLoc,
+		builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()))
+	if err != nil {
+		return err
+	}
+	if err := execute(ctx, builder.WithValidateCommands(asgmtEnv), flags.plan); err != nil {
+		return err
+	}
+	if !*flags.plan.enabled {
+		fmt.Printf("%s is valid\n", *flags.configFilepath)
+	}
+	return nil
+}
+
+// runUpdate resolves the base image and language image of the configuration again,
+// ignoring the digests pinned by the lock file, and writes the resolved digests to the lock file.
+func runUpdate(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("update")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(false, *flags.registry, *flags.configFilepath, *flags.dockerfileLoc,
+		builder.WithEnvLockUpdate(), builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()))
+	if err != nil {
+		return err
+	}
+	if err := execute(ctx, builder.WithUpdateCommands(asgmtEnv), flags.plan); err != nil {
+		return err
+	}
+	if !*flags.plan.enabled {
+		fmt.Printf("%s is up to date\n", configurations.GetEnvLockFilepath(*flags.configFilepath))
+	}
+	return nil
+}
+
+// runRender prints the dockerfile for the configuration.
+func runRender(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("render")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(false, *flags.registry, *flags.configFilepath, *flags.dockerfileLoc,
+		builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()))
+	if err != nil {
+		return err
+	}
+	return execute(ctx, builder.WithRenderCommands(asgmtEnv, os.Stdout), flags.plan)
+}
+
+// runBuild builds the image for the configuration without publishing it.
+func runBuild(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("build")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(false, *flags.registry, *flags.configFilepath,
+		*flags.dockerfileLoc, builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()),
+		builder.WithVerbose(*flags.verbose))
+	if err != nil {
+		return err
+	}
+	return execute(ctx, builder.WithBuildCommands(asgmtEnv), flags.plan)
+}
+
+// runPublish publishes the existing local image for the configuration.
+func runPublish(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("publish")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(true, *flags.registry, *flags.configFilepath,
+		*flags.dockerfileLoc, builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()))
+	if err != nil {
+		return err
+	}
+	return execute(ctx, builder.WithPublishCommands(asgmtEnv, os.Stdout), flags.plan)
+}
+
+// runInspect shows the details of the image for the configuration.
+func runInspect(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("inspect")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+	renderer, err := flags.newProgressRenderer()
+	if err != nil {
+		return err
+	}
+	asgmtEnv, err := builder.GetConfigurations(false, *flags.registry, *flags.configFilepath, *flags.dockerfileLoc,
+		builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()))
+	if err != nil {
+		return err
+	}
+	return execute(ctx, builder.WithInspectCommands(asgmtEnv, os.Stdout), flags.plan)
+}
+
+// runClean removes the local images created by the image builder.
+func runClean(ctx context.Context, args []string) error {
+	flagSet := flag.NewFlagSet("clean", flag.ExitOnError)
+	plan := addPlanFlags(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	engine, err := builder.NewDockerEngine()
+	if err != nil {
+		return err
+	}
+	return execute(ctx, builder.WithCleanCommands(engine, os.Stdout), plan)
+}
+
+// runMatrix builds the image of every variant expanded from the matrix of the configuration,
+// in parallel up to the concurrency limit, and prints the summary of the variants.
+// It returns error if any variant fails, once all variants have been built.
+func runMatrix(ctx context.Context, args []string) error {
+	flagSet, flags := newConfigFlagSet("matrix")
+	publish := flagSet.Bool("publishImage", false, "Publish the image of every variant to the registry")
+	concurrency := flagSet.Int("concurrency", 2, "Number of variants built concurrently")
+	if err := flags.parse(flagSet, args); err != nil {
+		return err
+	}
+
+	// Progress bars cannot show concurrent builds, so progress is shown as text unless requested as JSON.
+	progressFormat := builder.PlainProgress
+	if *flags.progress == builder.JSONProgress {
+		progressFormat = builder.JSONProgress
+	}
+	renderer, err := builder.NewProgressRenderer(progressFormat, os.Stderr)
+	if err != nil {
+		return err
+	}
+	variants, err := builder.GetMatrixConfigurations(*publish, *flags.registry, *flags.configFilepath,
+		*flags.dockerfileLoc, builder.WithProgressRenderer(renderer), builder.WithPhaseTimeouts(flags.timeouts.get()),
+		builder.WithVerbose(*flags.verbose))
+	if err != nil {
+		return err
+	}
+
+	if *flags.plan.enabled {
+		for _, variant := range variants {
+			fmt.Printf("Variant: %s\n", variant.Name)
+			if err := execute(ctx, variant.Commands(), flags.plan); err != nil {
+				return fmt.Errorf("error in planning variant %s: %v", variant.Name, err)
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	store, err := openHistoryStore()
+	if err != nil {
+		return err
+	}
+	matrixBuilder, err := builder.NewMatrixBuilder(
+		builder.WithMatrixVariants(variants),
+		builder.WithConcurrencyLimit(*concurrency),
+		builder.WithMatrixHistory(store))
+	if err != nil {
+		return err
+	}
+	results := matrixBuilder.Execute(ctx)
+	fmt.Println()
+	if err := builder.WriteMatrixSummary(os.Stdout, results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d variants failed", failed, len(results))
+	}
+	return nil
+}
+
+// runCatalog runs the action of the catalog subcommand. The build action validates every assignment
+// of the catalog, builds the images of its unique environments that are not in the registry yet,
+// prints the summary of the environments and writes the lock file once all have been built.
+// The images in the registry are checked against the existing lock file, if any, and the lock
+// file is written for the environments that succeeded even if others failed.
+func runCatalog(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "build" {
+		return fmt.Errorf("usage: catalog build [options]")
+	}
+	flagSet := flag.NewFlagSet("catalog build", flag.ExitOnError)
+	catalogFilepath := flagSet.String("catalog", "catalog.yaml", "Course catalog filepath")
+	lockFilepath := flagSet.String("lockFile", "", "Lock file to write (defaults to the catalog with the .lock extension)")
+	publish := flagSet.Bool("publishImage", true, "Publish the built images to the registry")
+	registry := flagSet.String("registry", "", "Registry to verify and publish images against (overrides the configs, defaults to docker.io)")
+	progress := flagSet.String("progress", builder.PlainProgress, "Progress output format (plain or json)")
+	timeouts := addTimeoutFlags(flagSet)
+	scriptsDir := addScriptsDirFlag(flagSet)
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := useScriptsDir(*scriptsDir); err != nil {
+		return err
+	}
+	if *lockFilepath == "" {
+		*lockFilepath = catalog.GetLockFilepath(*catalogFilepath)
+	}
+
+	courseCatalog, err := catalog.LoadCatalog(*catalogFilepath)
+	if err != nil {
+		return err
+	}
+	renderer, err := builder.NewProgressRenderer(*progress, os.Stderr)
+	if err != nil {
+		return err
+	}
+	store, err := openHistoryStore()
+	if err != nil {
+		return err
+	}
+	options := []catalog.BuilderOption{
+		catalog.WithRegistry(*registry),
+		catalog.WithPublishImage(*publish),
+		catalog.WithPhaseTimeouts(timeouts.get()),
+		catalog.WithHistoryStore(store),
+		catalog.WithProgressRenderer(renderer)}
+	if _, err := os.Stat(*lockFilepath); err == nil {
+		locked, err := catalog.ReadLockFile(*lockFilepath)
+		if err != nil {
+			return err
+		}
+		options = append(options, catalog.WithLockFile(locked))
+	}
+	catalogBuilder, err := catalog.NewBuilder(options...)
+	if err != nil {
+		return err
+	}
+
+	lockFile, environments, err := catalogBuilder.Build(ctx, courseCatalog)
+	if environments != nil {
+		fmt.Println()
+		if summaryErr := catalog.WriteSummary(os.Stdout, environments); summaryErr != nil {
+			return summaryErr
+		}
+	}
+	if lockFile == nil {
+		return err
+	}
+	if writeErr := lockFile.Write(*lockFilepath); writeErr != nil {
+		return writeErr
+	}
+	fmt.Printf("\nLocked %d of %d assignments in %s\n", len(lockFile.Assignments),
+		len(courseCatalog.Assignments), *lockFilepath)
+	return err
+}
+
+// runServe serves the REST API of the build service until the context is done.
+// The running builds are cancelled and undone upon shutdown.
+func runServe(ctx context.Context, args []string) error {
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flagSet.String("addr", ":8080", "Address to serve the REST API on")
+	workers := flagSet.Int("workers", 2, "Number of jobs built concurrently")
+	queueSize := flagSet.Int("queueSize", 16, "Number of jobs that can wait for a worker")
+	workDir := flagSet.String("workDir", os.TempDir(), "Directory holding the configuration and Dockerfile of the running jobs")
+	timeouts := addTimeoutFlags(flagSet)
+	scriptsDir := addScriptsDirFlag(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if err := useScriptsDir(*scriptsDir); err != nil {
+		return err
+	}
+
+	store, err := openHistoryStore()
+	if err != nil {
+		return err
+	}
+	buildServer, err := server.NewServer(
+		server.WithHistoryStore(store),
+		server.WithWorkers(*workers),
+		server.WithQueueSize(*queueSize),
+		server.WithWorkDir(*workDir),
+		server.WithPhaseTimeouts(timeouts.get()))
+	if err != nil {
+		return err
+	}
+	buildServer.Start(ctx)
+
+	httpServer := &http.Server{Addr: *addr, Handler: buildServer.Handler()}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	log.Printf("serving the image builder on %s", *addr)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// openHistoryStore opens the history store in its default directory.
+func openHistoryStore() (*history.Store, error) {
+	dir, err := history.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return history.NewStore(dir)
+}
+
+// runLanguages lists the languages and versions that have an installation script,
+// with the description given by the header comment of the script.
+func runLanguages(_ context.Context, args []string) error {
+	flagSet := flag.NewFlagSet("languages", flag.ExitOnError)
+	scriptsDir := addScriptsDirFlag(flagSet)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if err := useScriptsDir(*scriptsDir); err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "LANGUAGE\tVERSION\tDESCRIPTION\n")
+	for _, script := range scripts.Default().List() {
+		description := script.Description
+		if script.Overridden {
+			description += " (from " + *scriptsDir + ")"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", script.Language, script.Version, description)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,20 @@
+// Package shell contains utilities to help generate shell commands.
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unquotedPattern matches the values that need no quoting for the shell.
+var unquotedPattern = regexp.MustCompile(`^[A-Za-z0-9._+:@/=-]+$`)
+
+// Quote quotes the value as a single word for the shell if it contains any character
+// other than those commonly found in package names and versions.
+func Quote(value string) string {
+	if unquotedPattern.MatchString(value) {
+		return value
+	}
+	return fmt.Sprintf("'%s'", strings.Replace(value, "'", `'"'"'`, -1))
+}